@@ -0,0 +1,186 @@
+package yt
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// An api makes requests to the YouTube Data API on behalf of the clients
+// which use it (such as the SearchClient).
+type api struct {
+	auth    func() (string, error)
+	url     *url.URL
+	timeout time.Duration
+	client  *http.Client
+}
+
+// fetch gets the JSON resource at the given path (relative to the api's URL)
+// with the given query, and decodes it into v.
+func (a *api) fetch(ctx context.Context, path string, query url.Values, v interface{}) error {
+	auth, err := a.auth()
+	if err != nil {
+		return err
+	}
+
+	u, err := url.Parse(a.url.String())
+	if err != nil {
+		return err
+	}
+	if path != "" {
+		u = u.ResolveReference(&url.URL{Path: path})
+	}
+	q := u.Query()
+	for k, vs := range query {
+		q[k] = vs
+	}
+	u.RawQuery = q.Encode()
+
+	if a.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", ContentTypeJSON)
+	authorize(req, auth)
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{resp.StatusCode, resp.Status}
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// videos fills in the durations and view counts of the given videos, which
+// are keyed by ID, with a single lookup.
+func (a *api) videos(ctx context.Context, ids []string, videos map[string]*Video) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	q := url.Values{}
+	q.Set("part", "contentDetails,statistics")
+	q.Set("id", strings.Join(ids, ","))
+	details := new(detailsPage)
+	if err := a.fetch(ctx, "videos", q, details); err != nil {
+		return err
+	}
+	for _, d := range details.Items {
+		if v, ok := videos[d.ID]; ok {
+			v.Duration, _ = parseISODuration(d.ContentDetails.Duration)
+			v.Views, _ = strconv.ParseInt(d.Statistics.ViewCount, 10, 64)
+		}
+	}
+	return nil
+}
+
+// channels fills in the subscriber counts and uploads playlists of the given
+// channels, which are keyed by ID, with a single lookup.
+func (a *api) channels(ctx context.Context, ids []string, channels map[string]*Channel) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	q := url.Values{}
+	q.Set("part", "contentDetails,statistics")
+	q.Set("id", strings.Join(ids, ","))
+	details := new(detailsPage)
+	if err := a.fetch(ctx, "channels", q, details); err != nil {
+		return err
+	}
+	for _, d := range details.Items {
+		if ch, ok := channels[d.ID]; ok {
+			ch.Subscribers, _ = strconv.ParseInt(d.Statistics.SubscriberCount, 10, 64)
+			if id := d.ContentDetails.RelatedPlaylists.Uploads; id != "" {
+				ch.UploadsPlaylistID = id
+			}
+		}
+	}
+	return nil
+}
+
+// playlists fills in the item counts of the given playlists, which are keyed
+// by ID, with a single lookup.
+func (a *api) playlists(ctx context.Context, ids []string, playlists map[string]*Playlist) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	q := url.Values{}
+	q.Set("part", "contentDetails")
+	q.Set("id", strings.Join(ids, ","))
+	details := new(detailsPage)
+	if err := a.fetch(ctx, "playlists", q, details); err != nil {
+		return err
+	}
+	for _, d := range details.Items {
+		if p, ok := playlists[d.ID]; ok {
+			p.ItemCount = d.ContentDetails.ItemCount
+		}
+	}
+	return nil
+}
+
+// A snippet holds the basic details of an API resource
+type snippet struct {
+	PublishedAt            time.Time             `json:"publishedAt"`
+	ChannelID              string                `json:"channelId"`
+	ChannelTitle           string                `json:"channelTitle"`
+	Title                  string                `json:"title"`
+	Thumbnails             map[string]*Thumbnail `json:"thumbnails"`
+	VideoOwnerChannelID    string                `json:"videoOwnerChannelId"`
+	VideoOwnerChannelTitle string                `json:"videoOwnerChannelTitle"`
+	ResourceID             struct {
+		VideoID string `json:"videoId"`
+	} `json:"resourceId"`
+}
+
+// thumbnails gets the snippet's thumbnails, smallest first
+func (s *snippet) thumbnails() []*Thumbnail {
+	var ts []*Thumbnail
+	for _, t := range s.Thumbnails {
+		ts = append(ts, t)
+	}
+	sort.Slice(ts, func(i, j int) bool {
+		if ts[i].Width != ts[j].Width {
+			return ts[i].Width < ts[j].Width
+		}
+		return ts[i].URL < ts[j].URL
+	})
+	return ts
+}
+
+// A detailsPage contains the details of videos, channels or playlists which
+// other resources leave out
+type detailsPage struct {
+	Items []*details `json:"items"`
+}
+
+// The details of a single video, channel or playlist
+type details struct {
+	ID             string   `json:"id"`
+	Snippet        *snippet `json:"snippet"`
+	ContentDetails struct {
+		Duration         string `json:"duration"`
+		ItemCount        int64  `json:"itemCount"`
+		RelatedPlaylists struct {
+			Uploads string `json:"uploads"`
+		} `json:"relatedPlaylists"`
+	} `json:"contentDetails"`
+	Statistics struct {
+		ViewCount       string `json:"viewCount"`
+		SubscriberCount string `json:"subscriberCount"`
+	} `json:"statistics"`
+}
@@ -0,0 +1,272 @@
+package yt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DeviceCodeURL is the URL from which a DeviceAuth gets device codes
+var DeviceCodeURL *url.URL
+
+// TokenURL is the URL from which OAuth 2.0 tokens are got
+var TokenURL *url.URL
+
+// DefaultScopes are the OAuth 2.0 scopes requested by a DeviceAuth which
+// doesn't specify any
+var DefaultScopes = []string{"https://www.googleapis.com/auth/youtube"}
+
+// pollUnit is the unit of the intervals at which a DeviceAuth polls for its
+// token (which the server gives in seconds)
+var pollUnit = time.Second
+
+// A Token is an OAuth 2.0 access token, and the refresh token which can be
+// used to get another when it expires.
+type Token struct {
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	Expiry       time.Time `json:"expiry"`
+}
+
+// Valid checks whether the token has an access token which hasn't expired
+// (or is about to).
+func (t *Token) Valid() bool {
+	return t != nil && t.AccessToken != "" && (t.Expiry.IsZero() || time.Until(t.Expiry) > 10*time.Second)
+}
+
+// An AuthError is an error response from an OAuth 2.0 server, such as
+// "access_denied" or "expired_token".
+type AuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+// Error implements error
+func (e *AuthError) Error() string {
+	if e.Description == "" {
+		return "oauth2: " + e.Code
+	}
+	return fmt.Sprintf("oauth2: %s (%s)", e.Code, e.Description)
+}
+
+// A DeviceAuth authorizes requests with the OAuth 2.0 flow for devices with
+// limited input: it gets a code, which its Prompt asks the user to enter at
+// a verification URL, and then polls for a token until they have. When the
+// token expires, it's refreshed with its refresh token; the user is only
+// asked again if there's none, or it's been revoked. Its Auth method can be
+// used as an AuthFunc (such as an InfoClient's). A zero DeviceAuth (with a
+// ClientID, ClientSecret and Prompt) uses defaults.
+type DeviceAuth struct {
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	CodeURL      *url.URL
+	TokenURL     *url.URL
+	HTTP         *http.Client
+	Prompt       func(verificationURL, userCode string)
+
+	mu      sync.Mutex
+	token   *Token
+	refresh *tokenRefresh
+}
+
+// Auth gets an access token with Token.
+func (d *DeviceAuth) Auth() (string, error) {
+	t, err := d.Token(context.Background())
+	if err != nil {
+		return "", err
+	}
+	return t.AccessToken, nil
+}
+
+// Token gets a valid token, refreshing it if it has expired, or authorizing
+// the device if it hasn't been. Callers which need it at the same time share
+// the refresh (or the wait for the user); a caller whose context is done
+// stops waiting for it.
+func (d *DeviceAuth) Token(ctx context.Context) (*Token, error) {
+	d.mu.Lock()
+	if d.token.Valid() {
+		t := d.token
+		d.mu.Unlock()
+		return t, nil
+	}
+	r := d.refresh
+	if r == nil {
+		r = &tokenRefresh{done: make(chan struct{})}
+		d.refresh = r
+		go d.renew(r, d.token)
+	}
+	d.mu.Unlock()
+
+	select {
+	case <-r.done:
+		return r.token, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// renew gets a new token to replace old (which may be nil), using its
+// refresh token, or else (or if that's been revoked) by authorizing.
+func (d *DeviceAuth) renew(r *tokenRefresh, old *Token) {
+	ctx := context.Background()
+	var e *AuthError
+	if old != nil && old.RefreshToken != "" {
+		r.token, r.err = oauthExchange(ctx, d.HTTP, d.TokenURL, url.Values{
+			"client_id":     {d.ClientID},
+			"client_secret": {d.ClientSecret},
+			"refresh_token": {old.RefreshToken},
+			"grant_type":    {"refresh_token"},
+		})
+		if r.err == nil && r.token.RefreshToken == "" {
+			r.token.RefreshToken = old.RefreshToken
+		}
+	}
+	if old == nil || old.RefreshToken == "" || errors.As(r.err, &e) && e.Code == "invalid_grant" {
+		r.token, r.err = d.Authorize(ctx)
+	}
+
+	d.mu.Lock()
+	if r.err == nil {
+		d.token = r.token
+	}
+	d.refresh = nil
+	d.mu.Unlock()
+	close(r.done)
+}
+
+// Authorize goes through the device flow, returning the token once the user
+// has entered the code, or an error (such as an *AuthError) if they refuse,
+// the code expires or the context is done.
+func (d *DeviceAuth) Authorize(ctx context.Context) (*Token, error) {
+	if d.Prompt == nil {
+		return nil, errors.New("DeviceAuth has no Prompt")
+	}
+	scopes := d.Scopes
+	if len(scopes) == 0 {
+		scopes = DefaultScopes
+	}
+	code := new(struct {
+		DeviceCode      string `json:"device_code"`
+		UserCode        string `json:"user_code"`
+		VerificationURL string `json:"verification_url"`
+		VerificationURI string `json:"verification_uri"`
+		Interval        int    `json:"interval"`
+	})
+	codeURL := d.CodeURL
+	if codeURL == nil {
+		codeURL = DeviceCodeURL
+	}
+	if err := oauthPost(ctx, d.HTTP, codeURL, url.Values{
+		"client_id": {d.ClientID},
+		"scope":     {strings.Join(scopes, " ")},
+	}, code); err != nil {
+		return nil, err
+	}
+	if code.VerificationURL == "" {
+		code.VerificationURL = code.VerificationURI
+	}
+	d.Prompt(code.VerificationURL, code.UserCode)
+
+	interval := time.Duration(code.Interval) * pollUnit
+	if interval <= 0 {
+		interval = 5 * pollUnit
+	}
+	for {
+		if err := sleep(ctx, interval); err != nil {
+			return nil, err
+		}
+		t, err := oauthExchange(ctx, d.HTTP, d.TokenURL, url.Values{
+			"client_id":     {d.ClientID},
+			"client_secret": {d.ClientSecret},
+			"device_code":   {code.DeviceCode},
+			"grant_type":    {"urn:ietf:params:oauth:grant-type:device_code"},
+		})
+		var e *AuthError
+		if errors.As(err, &e) {
+			switch e.Code {
+			case "authorization_pending":
+				continue
+			case "slow_down":
+				interval += 5 * pollUnit
+				continue
+			}
+		}
+		return t, err
+	}
+}
+
+// oauthExchange gets a token from the token endpoint at u (or TokenURL) with the
+// given grant, using the client c (or DefaultHTTPClient)
+func oauthExchange(ctx context.Context, c *http.Client, u *url.URL, grant url.Values) (*Token, error) {
+	if u == nil {
+		u = TokenURL
+	}
+	resp := new(struct {
+		Token
+		ExpiresIn int `json:"expires_in"`
+	})
+	if err := oauthPost(ctx, c, u, grant, resp); err != nil {
+		return nil, err
+	}
+	if resp.AccessToken == "" {
+		return nil, &MalformedResponseError{errors.New("no access_token")}
+	}
+	t := resp.Token
+	if resp.ExpiresIn > 0 {
+		t.Expiry = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+	}
+	return &t, nil
+}
+
+// oauthPost posts a form to an OAuth 2.0 endpoint, using the client c (or
+// DefaultHTTPClient), and decodes the JSON response into v. If the response
+// is an error, it's returned as an *AuthError.
+func oauthPost(ctx context.Context, c *http.Client, u *url.URL, form url.Values, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", ContentTypeJSON)
+
+	if c == nil {
+		c = DefaultHTTPClient
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); contentType != ContentTypeJSON {
+		if resp.StatusCode != http.StatusOK {
+			return &StatusError{resp.StatusCode, resp.Status}
+		}
+		return &MalformedResponseError{fmt.Errorf("unexpected response content type %q", resp.Header.Get("Content-Type"))}
+	}
+	if resp.StatusCode != http.StatusOK {
+		e := new(AuthError)
+		if err := json.NewDecoder(resp.Body).Decode(e); err != nil || e.Code == "" {
+			return &StatusError{resp.StatusCode, resp.Status}
+		}
+		return e
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return &MalformedResponseError{err}
+	}
+	return nil
+}
+
+func init() {
+	DeviceCodeURL, _ = url.Parse("https://oauth2.googleapis.com/device/code")
+	TokenURL, _ = url.Parse("https://oauth2.googleapis.com/token")
+}
@@ -0,0 +1,255 @@
+package yt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTokenServer is a local OAuth 2.0 server for devices. Each device code
+// it gives out is answered with the given responses to successive polls:
+// "pending", "slow_down", "denied", "token", or anything else (which is
+// sent as the status).
+func fakeTokenServer(t *testing.T, responses ...string) (*httptest.Server, *int) {
+	var polls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("client_id") != "client" {
+			t.Errorf("expected the client ID, got %q", r.Form.Get("client_id"))
+		}
+		w.Header().Set("Content-Type", ContentTypeJSON)
+		switch r.URL.Path {
+		case "/device/code":
+			if scope := r.Form.Get("scope"); scope != "https://www.googleapis.com/auth/youtube" {
+				t.Errorf("expected the default scope, got %q", scope)
+			}
+			fmt.Fprint(w, `{"device_code":"device","user_code":"ABC-DEF","verification_url":"https://www.google.com/device","expires_in":1800,"interval":1}`)
+		case "/token":
+			if r.Form.Get("device_code") != "device" || r.Form.Get("client_secret") != "secret" {
+				t.Errorf("unexpected token request %v", r.Form)
+			}
+			response := responses[polls]
+			polls++
+			switch response {
+			case "pending":
+				w.WriteHeader(http.StatusPreconditionRequired)
+				fmt.Fprint(w, `{"error":"authorization_pending","error_description":"Precondition Required"}`)
+			case "slow_down":
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, `{"error":"slow_down"}`)
+			case "denied":
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, `{"error":"access_denied","error_description":"Forbidden"}`)
+			case "token":
+				fmt.Fprintf(w, `{"access_token":"access%d","expires_in":3599,"refresh_token":"refresh","token_type":"Bearer"}`, polls)
+			case "short":
+				fmt.Fprint(w, `{"access_token":"short","expires_in":1}`)
+			case "empty":
+				fmt.Fprint(w, `{}`)
+			default:
+				w.Header().Set("Content-Type", "text/html")
+				var status int
+				fmt.Sscan(response, &status)
+				w.WriteHeader(status)
+			}
+		}
+	}))
+	return ts, &polls
+}
+
+// testDeviceAuth makes a DeviceAuth which uses the server, and the prompts
+// it gives.
+func testDeviceAuth(ts *httptest.Server, prompts *[]string) *DeviceAuth {
+	codeURL, _ := url.Parse(ts.URL + "/device/code")
+	tokenURL, _ := url.Parse(ts.URL + "/token")
+	return &DeviceAuth{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		CodeURL:      codeURL,
+		TokenURL:     tokenURL,
+		Prompt: func(u, code string) {
+			*prompts = append(*prompts, u+" "+code)
+		},
+	}
+}
+
+func TestDeviceAuth(t *testing.T) {
+	defer func(u time.Duration) { pollUnit = u }(pollUnit)
+	pollUnit = time.Millisecond
+
+	ts, polls := fakeTokenServer(t, "pending", "slow_down", "pending", "token", "token")
+	defer ts.Close()
+	var prompts []string
+	d := testDeviceAuth(ts, &prompts)
+
+	token, err := d.Authorize(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if token.AccessToken != "access4" || token.RefreshToken != "refresh" || !token.Valid() || time.Until(token.Expiry) < time.Hour-time.Minute {
+		t.Errorf("unexpected token %+v", token)
+	}
+	if fmt.Sprint(prompts) != "[https://www.google.com/device ABC-DEF]" {
+		t.Errorf("expected the user to be prompted once, got %v", prompts)
+	}
+
+	for i := 0; i < 2; i++ {
+		if s, err := d.Auth(); err != nil || s != "access5" {
+			t.Errorf("expected the cached access token, got %q (%v)", s, err)
+		}
+	}
+	if *polls != 5 {
+		t.Errorf("expected 5 polls, got %d", *polls)
+	}
+}
+
+func TestDeviceAuthErrors(t *testing.T) {
+	defer func(u time.Duration) { pollUnit = u }(pollUnit)
+	pollUnit = time.Millisecond
+
+	ts, _ := fakeTokenServer(t, "denied", "500", "200", "empty", "short", "token")
+	defer ts.Close()
+	var prompts []string
+	d := testDeviceAuth(ts, &prompts)
+
+	_, err := d.Auth()
+	var e *AuthError
+	if !errors.As(err, &e) || e.Code != "access_denied" || err.Error() != "oauth2: access_denied (Forbidden)" {
+		t.Errorf("expected access to be denied, got %v", err)
+	}
+	var s *StatusError
+	if _, err := d.Authorize(context.Background()); !errors.As(err, &s) || s.StatusCode != 500 {
+		t.Errorf("expected a 500, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := d.Authorize(context.Background()); !errors.Is(err, ErrMalformedResponse) {
+			t.Errorf("expected a malformed response, got %v", err)
+		}
+	}
+	if s, err := d.Auth(); err != nil || s != "short" {
+		t.Errorf("expected a short-lived token, got %q (%v)", s, err)
+	}
+	if s, err := d.Auth(); err != nil || s != "access6" {
+		t.Errorf("expected a new token when the short one expired, got %q (%v)", s, err)
+	}
+	if (&AuthError{Code: "expired_token"}).Error() != "oauth2: expired_token" {
+		t.Errorf("unexpected error message")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := d.Authorize(ctx); err == nil {
+		t.Errorf("expected an error when the context is done")
+	}
+	pollUnit = time.Hour
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := d.Authorize(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected the deadline to be exceeded while polling, got %v", err)
+	}
+	if _, err := (&DeviceAuth{}).Auth(); err == nil {
+		t.Errorf("expected an error without a Prompt")
+	}
+	d.CodeURL = &url.URL{Scheme: "bogus"}
+	if _, err := d.Authorize(context.Background()); err == nil {
+		t.Errorf("expected a transport error")
+	}
+	d.CodeURL = &url.URL{Host: "%zz"}
+	if _, err := d.Authorize(context.Background()); err == nil {
+		t.Errorf("expected a URL error")
+	}
+}
+
+func TestDeviceAuthRefresh(t *testing.T) {
+	defer func(u time.Duration) { pollUnit = u }(pollUnit)
+	pollUnit = time.Millisecond
+
+	var mu sync.Mutex
+	var refreshes []string
+	revoked := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		w.Header().Set("Content-Type", ContentTypeJSON)
+		switch {
+		case r.URL.Path == "/device/code":
+			fmt.Fprint(w, `{"device_code":"device","user_code":"ABC-DEF","verification_url":"https://www.google.com/device","interval":1}`)
+		case r.Form.Get("grant_type") == "refresh_token":
+			mu.Lock()
+			defer mu.Unlock()
+			refreshes = append(refreshes, r.Form.Get("refresh_token"))
+			if revoked {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error":"invalid_grant","error_description":"Token has been expired or revoked."}`)
+				return
+			}
+			fmt.Fprint(w, `{"access_token":"refreshed","expires_in":3599}`)
+		default:
+			fmt.Fprint(w, `{"access_token":"device","expires_in":1,"refresh_token":"refresh"}`)
+		}
+	}))
+	defer ts.Close()
+	prompts := make(chan string, 2)
+	release := make(chan struct{})
+	d := testDeviceAuth(ts, nil)
+	d.Prompt = func(u, code string) {
+		prompts <- code
+		<-release
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := d.Token(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected to stop waiting for the user when the context is done, got %v", err)
+	}
+	close(release)
+	if s, err := d.Auth(); err != nil || s != "device" {
+		t.Errorf("expected the device's token, got %q (%v)", s, err)
+	}
+	if s, err := d.Auth(); err != nil || s != "refreshed" {
+		t.Errorf("expected the expired token to be refreshed, got %q (%v)", s, err)
+	}
+	if s, err := d.Auth(); err != nil || s != "refreshed" {
+		t.Errorf("expected the refreshed token to be cached, got %q (%v)", s, err)
+	}
+	if len(prompts) != 1 || fmt.Sprint(refreshes) != "[refresh]" {
+		t.Errorf("expected the user to be prompted once, and the token refreshed once, got %d and %v", len(prompts), refreshes)
+	}
+
+	mu.Lock()
+	revoked = true
+	mu.Unlock()
+	d.mu.Lock()
+	d.token.Expiry = time.Now()
+	d.mu.Unlock()
+	if s, err := d.Auth(); err != nil || s != "device" || len(prompts) != 2 {
+		t.Errorf("expected the device to be authorized again when its refresh token was revoked, got %q (%v)", s, err)
+	}
+}
+
+func TestToken(t *testing.T) {
+	var token *Token
+	if token.Valid() {
+		t.Errorf("expected a nil token to be invalid")
+	}
+	for expiry, valid := range map[time.Time]bool{
+		{}:                               true,
+		time.Now().Add(time.Minute):      true,
+		time.Now().Add(5 * time.Second):  false,
+		time.Now().Add(-5 * time.Second): false,
+	} {
+		if (&Token{AccessToken: "a", Expiry: expiry}).Valid() != valid {
+			t.Errorf("expected a token expiring at %v to be valid: %v", expiry, valid)
+		}
+	}
+	data, _ := json.Marshal(&Token{AccessToken: "a"})
+	if string(data) != `{"access_token":"a","expiry":"0001-01-01T00:00:00Z"}` {
+		t.Errorf("unexpected JSON %s", data)
+	}
+}
@@ -0,0 +1,287 @@
+package yt
+
+import (
+	"container/list"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheSize is the number of videos an LRUInfoCache holds if its Size
+// isn't set
+const DefaultCacheSize = 1000
+
+// DefaultSweepInterval is how often a DirInfoCache removes expired files, if
+// its SweepInterval isn't set
+const DefaultSweepInterval = time.Hour
+
+// cacheClock gets the time by which the caches expire info (so that tests can
+// change it)
+var cacheClock = time.Now
+
+// An LRUInfoCache is an InfoCache which holds info in memory, for up to Size
+// videos, evicting the least recently used. An Info is only kept until its
+// stream URLs expire (less Margin, so that they still work for a while after
+// it's served); info without an expiry isn't kept at all. The info it gets
+// says how long is left until its stream URLs expire, not how long was left
+// when it was put. A zero LRUInfoCache uses defaults. It's safe for
+// concurrent use.
+type LRUInfoCache struct {
+	Size   int
+	Margin time.Duration
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// An lruEntry is the info of a video in an LRUInfoCache, when it expires,
+// and when its stream URLs expire
+type lruEntry struct {
+	id      string
+	info    *Info
+	expires time.Time
+	streams time.Time
+}
+
+// Get implements InfoCache. It returns nil if the cache doesn't hold info
+// for the video, or if it has expired.
+func (c *LRUInfoCache) Get(id string) *Info {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[id]
+	if !ok {
+		return nil
+	}
+	entry := e.Value.(*lruEntry)
+	if !cacheClock().Before(entry.expires) {
+		c.remove(e)
+		return nil
+	}
+	c.order.MoveToFront(e)
+	return expiring(entry.info, entry.streams)
+}
+
+// Put implements InfoCache. If the cache is full, the least recently used
+// info is evicted.
+func (c *LRUInfoCache) Put(id string, info *Info) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.order, c.entries = list.New(), map[string]*list.Element{}
+	}
+	if e, ok := c.entries[id]; ok {
+		c.remove(e)
+	}
+	ttl := info.ttl()
+	if ttl <= c.Margin {
+		return
+	}
+	streams := cacheClock().Add(ttl)
+	c.entries[id] = c.order.PushFront(&lruEntry{id, info, streams.Add(-c.Margin), streams})
+
+	size := c.Size
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	for c.order.Len() > size {
+		c.remove(c.order.Back())
+	}
+}
+
+// Len gets the number of videos whose info is in the cache (some of which
+// may have expired)
+func (c *LRUInfoCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.order == nil {
+		return 0
+	}
+	return c.order.Len()
+}
+
+// remove removes an element from the cache
+func (c *LRUInfoCache) remove(e *list.Element) {
+	c.order.Remove(e)
+	delete(c.entries, e.Value.(*lruEntry).id)
+}
+
+// expiring gets a copy of info which says how long is left until its stream
+// URLs expire (at the given time), rather than how long was left when it was
+// fetched.
+func expiring(info *Info, expires time.Time) *Info {
+	if info.StreamingData == nil {
+		return info
+	}
+	i, sd := *info, *info.StreamingData
+	left := expires.Sub(cacheClock()).Round(time.Second)
+	sd.ExpiresInSeconds = strconv.Itoa(int(left / time.Second))
+	i.StreamingData = &sd
+	return &i
+}
+
+// A cachedInfo is how an Info is stored by the caches which serialize it,
+// with when it expires from the cache, and when its stream URLs expire.
+type cachedInfo struct {
+	Expires       time.Time `json:"expires"`
+	StreamsExpire time.Time `json:"streamsExpire"`
+	Info          *Info     `json:"info"`
+}
+
+// encodeCached serializes info for a cache, returning how long it should be
+// kept for, or false if it shouldn't be kept at all.
+func encodeCached(info *Info, margin time.Duration) ([]byte, time.Duration, bool) {
+	ttl := info.ttl()
+	if ttl <= margin {
+		return nil, 0, false
+	}
+	streams := cacheClock().Add(ttl)
+	data, err := json.Marshal(&cachedInfo{streams.Add(-margin), streams, info})
+	if err != nil {
+		return nil, 0, false
+	}
+	return data, ttl - margin, true
+}
+
+// decodeCached deserializes info from a cache, returning nil if it can't be
+// parsed or has expired. The info says how long is left until its stream
+// URLs expire.
+func decodeCached(data []byte) *Info {
+	c := new(cachedInfo)
+	if err := json.Unmarshal(data, c); err != nil || c.Info == nil || !cacheClock().Before(c.Expires) || c.StreamsExpire.IsZero() {
+		return nil
+	}
+	return expiring(c.Info, c.StreamsExpire)
+}
+
+// A DirInfoCache is an InfoCache which stores info as JSON files in Dir
+// (which must exist), named after the video IDs, so that it can outlive the
+// process and be shared by several. Files are replaced atomically. As with
+// an LRUInfoCache, info is only kept until its stream URLs expire, less
+// Margin; expired files are swept from Dir every SweepInterval as info is
+// put. Since InfoCache methods can't fail, errors reading and writing files
+// are ignored.
+type DirInfoCache struct {
+	Dir           string
+	Margin        time.Duration
+	SweepInterval time.Duration
+
+	mu    sync.Mutex
+	swept time.Time
+}
+
+// Get implements InfoCache
+func (c *DirInfoCache) Get(id string) *Info {
+	p, ok := c.path(id)
+	if !ok {
+		return nil
+	}
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil
+	}
+	return decodeCached(data)
+}
+
+// Put implements InfoCache. The file is replaced atomically, so that it's
+// never seen half-written.
+func (c *DirInfoCache) Put(id string, info *Info) {
+	p, ok := c.path(id)
+	if !ok {
+		return
+	}
+	defer c.sweep()
+	data, _, ok := encodeCached(info, c.Margin)
+	if !ok {
+		os.Remove(p)
+		return
+	}
+	writeFile(p, data)
+}
+
+// Sweep removes the files of expired (or unreadable) info from Dir
+func (c *DirInfoCache) Sweep() error {
+	paths, err := filepath.Glob(filepath.Join(c.Dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		if !InfoID.MatchString(strings.TrimSuffix(filepath.Base(p), ".json")) {
+			continue
+		}
+		data, err := ioutil.ReadFile(p)
+		if err == nil && decodeCached(data) != nil {
+			continue
+		}
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// sweep sweeps Dir if it hasn't been swept for SweepInterval
+func (c *DirInfoCache) sweep() {
+	interval := c.SweepInterval
+	if interval <= 0 {
+		interval = DefaultSweepInterval
+	}
+	c.mu.Lock()
+	due := cacheClock().Sub(c.swept) >= interval
+	if due {
+		c.swept = cacheClock()
+	}
+	c.mu.Unlock()
+	if due {
+		c.Sweep()
+	}
+}
+
+// path gets the path of the file for the video with the given ID, or false
+// if the ID isn't valid (and so may not be a safe file name).
+func (c *DirInfoCache) path(id string) (string, bool) {
+	if !InfoID.MatchString(id) {
+		return "", false
+	}
+	return filepath.Join(c.Dir, id+".json"), true
+}
+
+// A KVStore is a key-value store, such as Redis or memcached, in which a
+// KVInfoCache can keep info. Get returns a nil value (and no error) for a key
+// which isn't set; Set stores a value which should be forgotten after ttl.
+type KVStore interface {
+	Get(key string) ([]byte, error)
+	Set(key string, value []byte, ttl time.Duration) error
+}
+
+// A KVInfoCache is an InfoCache which keeps info as JSON in a KVStore, under
+// the video IDs with Prefix, so that it can be shared by several processes.
+// As with an LRUInfoCache, info is only kept until its stream URLs expire,
+// less Margin. Since InfoCache methods can't fail, errors from the KVStore
+// are ignored.
+type KVInfoCache struct {
+	KV     KVStore
+	Prefix string
+	Margin time.Duration
+}
+
+// Get implements InfoCache
+func (c *KVInfoCache) Get(id string) *Info {
+	data, err := c.KV.Get(c.Prefix + id)
+	if err != nil || data == nil {
+		return nil
+	}
+	return decodeCached(data)
+}
+
+// Put implements InfoCache
+func (c *KVInfoCache) Put(id string, info *Info) {
+	if data, ttl, ok := encodeCached(info, c.Margin); ok {
+		c.KV.Set(c.Prefix+id, data, ttl)
+	}
+}
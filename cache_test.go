@@ -0,0 +1,236 @@
+package yt
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testExpiring makes info whose stream URLs expire in the given number of
+// seconds
+func testExpiring(seconds string) *Info {
+	info := new(Info)
+	info.StreamingData = &struct {
+		ExpiresInSeconds string    `json:"expiresInSeconds"`
+		Formats          []*Format `json:"formats"`
+		AdaptiveFormats  []*Format `json:"adaptiveFormats"`
+		HLSManifestURL   string    `json:"hlsManifestUrl,omitempty"`
+		DASHManifestURL  string    `json:"dashManifestUrl,omitempty"`
+	}{ExpiresInSeconds: seconds}
+	return info
+}
+
+func TestLRUInfoCache(t *testing.T) {
+	c := &LRUInfoCache{Size: 2}
+	if c.Get("a") != nil || c.Len() != 0 {
+		t.Errorf("expected an empty cache")
+	}
+	cached := func(id string, info *Info) bool {
+		got := c.Get(id)
+		return got != nil && got.VideoDetails == info.VideoDetails
+	}
+	a, b, d := testExpiring("60"), testExpiring("60"), testExpiring("60")
+	a.VideoDetails, b.VideoDetails, d.VideoDetails = new(VideoDetails), new(VideoDetails), new(VideoDetails)
+	c.Put("a", a)
+	c.Put("b", b)
+	if !cached("a", a) {
+		t.Errorf("expected a to be cached")
+	}
+	c.Put("d", d)
+	if c.Get("b") != nil {
+		t.Errorf("expected b, the least recently used, to be evicted")
+	}
+	if !cached("a", a) || !cached("d", d) || c.Len() != 2 {
+		t.Errorf("expected a and d to be cached")
+	}
+
+	c.Put("a", testExpiring(""))
+	if c.Get("a") != nil || c.Len() != 1 {
+		t.Errorf("expected info without an expiry to replace, but not be cached")
+	}
+	c.Put("x", new(Info))
+	if c.Get("x") != nil {
+		t.Errorf("expected info without streaming data not to be cached")
+	}
+}
+
+func TestLRUInfoCacheExpiry(t *testing.T) {
+	defer withCacheClock()()
+	c := &LRUInfoCache{Margin: 30 * time.Second}
+	c.Put("a", testExpiring("60"))
+	cacheOffset = 29 * time.Second
+	if a := c.Get("a"); a == nil || a.ttl() != 31*time.Second {
+		t.Fatalf("expected a to be cached, expiring in 31s, got %+v", a)
+	}
+	cacheOffset = 30 * time.Second
+	if c.Get("a") != nil || c.Len() != 0 {
+		t.Errorf("expected a to expire")
+	}
+	c = &LRUInfoCache{Margin: time.Minute}
+	if c.Put("a", testExpiring("60")); c.Get("a") != nil {
+		t.Errorf("expected info expiring within the margin not to be cached")
+	}
+
+	c = new(LRUInfoCache)
+	for i := 0; i <= DefaultCacheSize; i++ {
+		c.Put(fmt.Sprint(i), testExpiring("60"))
+	}
+	if c.Len() != DefaultCacheSize || c.Get("0") != nil {
+		t.Errorf("expected the default size to be %d, got %d", DefaultCacheSize, c.Len())
+	}
+}
+
+func TestDirInfoCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := &DirInfoCache{Dir: dir}
+	if c.Get("abcdefghijk") != nil {
+		t.Errorf("expected an empty cache")
+	}
+	info := testExpiring("60")
+	info.VideoDetails = &VideoDetails{ID: "abcdefghijk", Title: "Cached"}
+	c.Put("abcdefghijk", info)
+	got := (&DirInfoCache{Dir: dir}).Get("abcdefghijk")
+	if got == nil || got.VideoDetails.Title != "Cached" || got.ttl() != time.Minute {
+		t.Fatalf("expected the info to be read back, got %+v", got)
+	}
+	if names := dirNames(dir); fmt.Sprint(names) != "[abcdefghijk.json]" {
+		t.Errorf("expected only the cache file to be left, got %v", names)
+	}
+
+	c.Put("abcdefghijk", testExpiring(""))
+	if c.Get("abcdefghijk") != nil || len(dirNames(dir)) != 0 {
+		t.Errorf("expected info without an expiry to replace, but not be cached")
+	}
+	c.Put("../escaped", info)
+	if c.Get("../escaped") != nil || len(dirNames(dir)) != 0 {
+		t.Errorf("expected an invalid ID not to be cached")
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "corrupted00.json"), []byte("{"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "notes.json"), []byte("{"), 0644)
+	if c.Get("corrupted00") != nil {
+		t.Errorf("expected a corrupted file to be ignored")
+	}
+	defer withCacheClock()()
+	c = &DirInfoCache{Dir: dir, Margin: 30 * time.Second, SweepInterval: time.Minute}
+	c.Put("expiring123", testExpiring("60"))
+	cacheOffset = 29 * time.Second
+	if got := c.Get("expiring123"); got == nil || got.ttl() != 31*time.Second {
+		t.Errorf("expected the info to be cached, expiring in 31s, got %+v", got)
+	}
+	cacheOffset = 30 * time.Second
+	if c.Get("expiring123") != nil {
+		t.Errorf("expected the info to expire")
+	}
+	c.Put("abcdefghijk", info)
+	if names := dirNames(dir); fmt.Sprint(names) != "[abcdefghijk.json expiring123.json notes.json]" {
+		t.Errorf("expected nothing to be swept until the sweep interval is up, got %v", names)
+	}
+	cacheOffset = 2 * time.Minute
+	c.Put("abcdefghijk", info)
+	if names := dirNames(dir); fmt.Sprint(names) != "[abcdefghijk.json notes.json]" {
+		t.Errorf("expected expired and corrupted files to be swept, got %v", names)
+	}
+
+	c = &DirInfoCache{Dir: filepath.Join(dir, "missing")}
+	if c.Put("abcdefghijk", info); c.Get("abcdefghijk") != nil {
+		t.Errorf("expected nothing to be cached in a missing directory")
+	}
+	if err := (&DirInfoCache{Dir: "["}).Sweep(); err == nil {
+		t.Errorf("expected an error sweeping a bad pattern")
+	}
+}
+
+// cacheOffset is how far the cacheClock is ahead, while a test is using
+// withCacheClock
+var cacheOffset time.Duration
+
+// withCacheClock makes the cacheClock stand still (at cacheOffset from now),
+// returning a function which restores it
+func withCacheClock() func() {
+	start := time.Now()
+	cacheOffset = 0
+	cacheClock = func() time.Time { return start.Add(cacheOffset) }
+	return func() { cacheClock = time.Now }
+}
+
+// dirNames lists the names of the files in dir
+func dirNames(dir string) []string {
+	files, _ := ioutil.ReadDir(dir)
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	return names
+}
+
+// A fakeKV is an in-process KVStore
+type fakeKV struct {
+	values map[string][]byte
+	ttls   map[string]time.Duration
+	err    error
+}
+
+// Get implements KVStore
+func (kv *fakeKV) Get(key string) ([]byte, error) {
+	return kv.values[key], kv.err
+}
+
+// Set implements KVStore
+func (kv *fakeKV) Set(key string, value []byte, ttl time.Duration) error {
+	if kv.err != nil {
+		return kv.err
+	}
+	kv.values[key], kv.ttls[key] = value, ttl
+	return nil
+}
+
+func TestKVInfoCache(t *testing.T) {
+	kv := &fakeKV{values: map[string][]byte{}, ttls: map[string]time.Duration{}}
+	c := &KVInfoCache{KV: kv, Prefix: "yt:", Margin: time.Minute}
+	if c.Get("abcdefghijk") != nil {
+		t.Errorf("expected an empty cache")
+	}
+	info := testExpiring("600")
+	info.VideoDetails = &VideoDetails{ID: "abcdefghijk"}
+	c.Put("abcdefghijk", info)
+	if ttl := kv.ttls["yt:abcdefghijk"]; ttl != 9*time.Minute {
+		t.Errorf("expected the info to be kept for 9m, got %v", ttl)
+	}
+	got := (&KVInfoCache{KV: kv, Prefix: "yt:"}).Get("abcdefghijk")
+	if got == nil || got.VideoDetails.ID != "abcdefghijk" {
+		t.Errorf("expected the info to be read back, got %+v", got)
+	}
+	defer withCacheClock()()
+	c.Put("abcdefghijk", info)
+	cacheOffset = 5 * time.Minute
+	if got := c.Get("abcdefghijk"); got == nil || got.ttl() != 5*time.Minute {
+		t.Errorf("expected the info to expire in 5m, got %+v", got)
+	}
+	c.Put("expiring123", testExpiring("60"))
+	if _, ok := kv.values["yt:expiring123"]; ok {
+		t.Errorf("expected info expiring within the margin not to be stored")
+	}
+
+	kv.values["yt:expired1234"] = []byte(`{"expires":"2000-01-01T00:00:00Z","info":{}}`)
+	kv.values["yt:corrupted00"] = []byte(`{`)
+	kv.values["yt:noexpiry00"] = []byte(`{"expires":"3000-01-01T00:00:00Z","info":{}}`)
+	for _, id := range []string{"expired1234", "corrupted00", "noexpiry00"} {
+		if c.Get(id) != nil {
+			t.Errorf("expected no info for %s", id)
+		}
+	}
+	kv.err = errors.New("connection refused")
+	if c.Put("abcdefghijk", info); c.Get("abcdefghijk") != nil {
+		t.Errorf("expected no info when the store fails")
+	}
+}
@@ -1 +1,176 @@
 package yt
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ChannelID is the regular expression which channel IDs must match
+var ChannelID *regexp.Regexp
+
+// ChannelURL is the URL of the endpoint from which we look up channels
+var ChannelURL *url.URL
+
+// A Channel contains information about a YouTube channel
+type Channel struct {
+	ID                string     `json:"id"`
+	Title             string     `json:"title"`
+	Subscribers       int64      `json:"subscribers"`
+	Avatar            *Thumbnail `json:"avatar"`
+	UploadsPlaylistID string     `json:"uploadsPlaylistId"`
+}
+
+// Type implements Result
+func (c *Channel) Type() string {
+	return "channel"
+}
+
+// A ChannelClient can look up channels and list their uploads. A zero
+// ChannelClient uses defaults. If Since is set, uploads published before it
+// are not listed (uploads without a publish time, such as private or deleted
+// ones, are). If Timeout is set, it limits the time spent fetching each
+// page of results. If Failed is set, it's called when a page of uploads after
+// the first fails.
+type ChannelClient struct {
+	AuthFunc func() (string, error)
+	URL      *url.URL
+	PerPage  int
+	Timeout  time.Duration
+	Client   *http.Client
+	Since    time.Time
+	Failed   func(*PageError)
+}
+
+// Resolve looks up a channel, which may be given as a channel ID, a @handle,
+// a legacy /user/ name, a /c/ custom name, or a URL of any of those. The API
+// can't look up custom names, so they're looked up as the handle of the same
+// name (which is what YouTube made most of them), and then as a username.
+func (c *ChannelClient) Resolve(ctx context.Context, ref string) (*Channel, error) {
+	if !isChannel(ref) {
+		if r, err := ParseURL(ref); err == nil && r.ChannelID != "" {
+			ref = r.ChannelID
+		}
+	}
+	var lookups []url.Values
+	switch {
+	case ChannelID.MatchString(ref):
+		lookups = append(lookups, url.Values{"id": {ref}})
+	case Handle.MatchString(ref):
+		lookups = append(lookups, url.Values{"forHandle": {ref}})
+	case strings.HasPrefix(ref, "/c/") && isChannel(ref):
+		name := strings.TrimPrefix(ref, "/c/")
+		if Handle.MatchString("@" + name) {
+			lookups = append(lookups, url.Values{"forHandle": {"@" + name}})
+		}
+		lookups = append(lookups, url.Values{"forUsername": {name}})
+	case isChannel(ref):
+		lookups = append(lookups, url.Values{"forUsername": {strings.TrimPrefix(ref, "/user/")}})
+	default:
+		return nil, fmt.Errorf("invalid channel %q", ref)
+	}
+
+	page := new(detailsPage)
+	for _, q := range lookups {
+		q.Set("part", "snippet,contentDetails,statistics")
+		if err := c.api().fetch(ctx, "", q, page); err != nil {
+			return nil, err
+		}
+		if len(page.Items) > 0 {
+			break
+		}
+	}
+	if len(page.Items) == 0 {
+		return nil, fmt.Errorf("channel %q not found", ref)
+	}
+
+	d := page.Items[0]
+	ch := &Channel{ID: d.ID, UploadsPlaylistID: d.ContentDetails.RelatedPlaylists.Uploads}
+	ch.Subscribers, _ = strconv.ParseInt(d.Statistics.SubscriberCount, 10, 64)
+	if ch.UploadsPlaylistID == "" && strings.HasPrefix(ch.ID, "UC") {
+		ch.UploadsPlaylistID = "UU" + ch.ID[2:]
+	}
+	if s := d.Snippet; s != nil {
+		ch.Title = s.Title
+		if ts := s.thumbnails(); len(ts) > 0 {
+			ch.Avatar = ts[len(ts)-1]
+		}
+	}
+	return ch, nil
+}
+
+// Get lists the uploads of a channel (given as anything Resolve accepts),
+// newest first. Like PlaylistClient.Get, the channel is closed after the last
+// upload (or the first one older than Since), when a page fails (after
+// calling Failed), or when the context is done.
+func (c *ChannelClient) Get(ctx context.Context, ref string) (chan *Video, error) {
+	ch, err := c.Resolve(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	a := c.api()
+	p := &PlaylistClient{
+		AuthFunc: a.auth,
+		URL:      a.url.ResolveReference(&url.URL{Path: "playlistItems"}),
+		PerPage:  c.PerPage,
+		Timeout:  c.Timeout,
+		Client:   a.client,
+		Failed:   c.Failed,
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	uploads, err := p.Get(ctx, ch.UploadsPlaylistID)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	videos := make(chan *Video)
+	go func(videos chan *Video) {
+		defer close(videos)
+		defer cancel()
+		for v := range uploads {
+			// private and deleted uploads have no publish time, so they
+			// don't say whether the rest are older
+			if !c.Since.IsZero() && !v.Published.IsZero() && v.Published.Before(c.Since) {
+				return
+			}
+			select {
+			case videos <- v:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}(videos)
+	return videos, nil
+}
+
+// api gets the api used by the ChannelClient, with defaults filled in
+func (c *ChannelClient) api() *api {
+	a := &api{c.AuthFunc, c.URL, c.Timeout, c.Client}
+	if a.auth == nil {
+		a.auth = AuthFunc
+	}
+	if a.url == nil {
+		a.url = ChannelURL
+	}
+	if a.client == nil {
+		a.client = DefaultHTTPClient
+	}
+	return a
+}
+
+// GetUploads lists the uploads of a channel, newest first.
+func GetUploads(ctx context.Context, ref string) (chan *Video, error) {
+	return new(ChannelClient).Get(ctx, ref)
+}
+
+func init() {
+	ChannelID = regexp.MustCompile("^UC([[:word:]]|-){22}$")
+	ChannelURL, _ = url.Parse("https://www.googleapis.com/youtube/v3/channels")
+}
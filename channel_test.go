@@ -1 +1,169 @@
 package yt
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const testChannelID = "UCxxxxxxxxxxxxxxxxxxxxxx"
+
+func TestGetUploads(t *testing.T) {
+	withChannelServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch r.URL.Path {
+		case "/videos":
+			fmt.Fprint(w, `{}`)
+		case "/playlistItems":
+			if id := q.Get("playlistId"); id != "UUxxxxxxxxxxxxxxxxxxxxxx" {
+				t.Errorf("unexpected uploads playlist %q", id)
+			}
+			fmt.Fprint(w, `{"items":[
+				{"contentDetails":{"videoId":"bbbbbbbbbbb","videoPublishedAt":"2020-05-02T00:00:00Z"}},
+				{"snippet":{"title":"Private video"},"contentDetails":{"videoId":"ppppppppppp"}},
+				{"contentDetails":{"videoId":"aaaaaaaaaaa","videoPublishedAt":"2020-05-01T00:00:00Z"}}
+			]}`)
+		default:
+			if q.Get("id") != testChannelID && q.Get("forHandle") != "@xyz" && q.Get("forUsername") != "x" && q.Get("forUsername") != "old" {
+				fmt.Fprint(w, `{"items":[]}`)
+				return
+			}
+			fmt.Fprint(w, `{"items":[{"id":"`+testChannelID+`",
+				"snippet":{"title":"X","thumbnails":{"default":{"url":"d","width":88}}},
+				"statistics":{"subscriberCount":"9"}
+			}]}`)
+		}
+	}), func() {
+		c := new(ChannelClient)
+		for _, ref := range []string{testChannelID, "@xyz", "/user/x", "https://www.youtube.com/@xyz/videos", "https://www.youtube.com/channel/" + testChannelID, "https://www.youtube.com/c/xyz", "/c/old"} {
+			ch, err := c.Resolve(context.Background(), ref)
+			if err != nil {
+				t.Errorf("expected no error resolving %q, got %v", ref, err)
+				continue
+			}
+			if ch.ID != testChannelID || ch.Title != "X" || ch.Subscribers != 9 || ch.Avatar.URL != "d" {
+				t.Errorf("unexpected channel %#v", ch)
+			}
+			if ch.UploadsPlaylistID != "UUxxxxxxxxxxxxxxxxxxxxxx" {
+				t.Errorf("expected uploads playlist to be derived from the channel ID, got %q", ch.UploadsPlaylistID)
+			}
+		}
+		for _, ref := range []string{"", "@", "/user/", "user/x", "foo", "@nobody", "/c/nobody"} {
+			if _, err := c.Resolve(context.Background(), ref); err == nil {
+				t.Errorf("expected an error resolving %q", ref)
+			}
+		}
+
+		vs, err := GetUploads(context.Background(), "@xyz")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		var ids []string
+		for v := range vs {
+			ids = append(ids, v.ID)
+		}
+		if fmt.Sprint(ids) != "[bbbbbbbbbbb ppppppppppp aaaaaaaaaaa]" {
+			t.Errorf("expected all uploads, newest first, got %v", ids)
+		}
+
+		c.Since = time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+		vs, err = c.Get(context.Background(), "@xyz")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		ids = nil
+		for v := range vs {
+			ids = append(ids, v.ID)
+		}
+		if fmt.Sprint(ids) != "[bbbbbbbbbbb ppppppppppp]" {
+			t.Errorf("expected uploads since %s, got %v", c.Since, ids)
+		}
+
+		if _, err := c.Get(context.Background(), "@nobody"); err == nil {
+			t.Errorf("expected an error listing an unknown channel")
+		}
+	})
+}
+
+func TestChannelClient(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/playlistItems":
+			if r.URL.Query().Get("playlistId") != "PLmoremoremore" || r.URL.Query().Get("pageToken") != "" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			fmt.Fprint(w, `{"nextPageToken":"x","items":[{"contentDetails":{"videoId":"a"}}]}`)
+		case "/videos":
+			fmt.Fprint(w, `{}`)
+		default:
+			fmt.Fprint(w, `{"items":[{"id":"`+testChannelID+`","contentDetails":{"relatedPlaylists":{"uploads":"`+r.URL.Query().Get("forHandle")[1:]+`"}}}]}`)
+		}
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	c := &ChannelClient{URL: u, Client: ts.Client()}
+	if _, err := c.Get(context.Background(), "@PLmissingmissing"); err == nil {
+		t.Errorf("expected an error listing a channel with missing uploads")
+	}
+
+	var e *PageError
+	c.Failed = func(err *PageError) { e = err }
+	vs, err := c.Get(context.Background(), "@PLmoremoremore")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	n := 0
+	for range vs {
+		n++
+	}
+	if n != 1 || e == nil || e.Page != 2 {
+		t.Errorf("expected uploads to stop with an error at page 2, got %d and %v", n, e)
+	}
+
+	c.URL = &url.URL{Scheme: "http", Host: "%zz"}
+	if _, err := c.Resolve(context.Background(), "@xyz"); err == nil {
+		t.Errorf("expected a URL error")
+	}
+}
+
+func TestChannelClientCancel(t *testing.T) {
+	withChannelServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/playlistItems":
+			fmt.Fprint(w, `{"nextPageToken":"x","items":[{"contentDetails":{"videoId":"a"}}]}`)
+		case "/videos":
+			fmt.Fprint(w, `{}`)
+		default:
+			fmt.Fprint(w, `{"items":[{"id":"`+testChannelID+`"}]}`)
+		}
+	}), func() {
+		var e *PageError
+		c := &ChannelClient{Failed: func(err *PageError) { e = err }}
+		ctx, cancel := context.WithCancel(context.Background())
+		vs, err := c.Get(ctx, testChannelID)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		<-vs
+		cancel()
+		for range vs {
+		}
+		if e != nil {
+			t.Errorf("expected no page error after cancelling, got %v", e)
+		}
+	})
+}
+
+func withChannelServer(h http.Handler, f func()) {
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL + "/channels")
+	defer func(u *url.URL) { ChannelURL = u }(ChannelURL)
+	ChannelURL = u
+	f()
+}
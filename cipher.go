@@ -0,0 +1,450 @@
+package yt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PlayerURL is the URL of the page from which we find the current version
+// of the player. Player scripts are fetched relative to it.
+var PlayerURL *url.URL
+
+// PlayerVersionTTL is how long a Decipherer trusts the player version it
+// last found.
+var PlayerVersionTTL = time.Hour
+
+// A Player holds the transforms which a version of the YouTube player applies
+// to stream URLs: the operations which decipher a signature, and the source
+// of the function which transforms the n parameter.
+type Player struct {
+	Version string
+	NFunc   string
+	ops     []cipherOp
+}
+
+// A cipherOp is a single step in deciphering a signature
+type cipherOp struct {
+	name string
+	arg  int
+}
+
+// Decipher applies the player's signature operations to s
+func (p *Player) Decipher(s string) string {
+	a := []byte(s)
+	for _, op := range p.ops {
+		switch op.name {
+		case "reverse":
+			for i, j := 0, len(a)-1; i < j; i, j = i+1, j-1 {
+				a[i], a[j] = a[j], a[i]
+			}
+		case "splice":
+			if op.arg > len(a) {
+				op.arg = len(a)
+			}
+			a = a[op.arg:]
+		case "swap":
+			if len(a) > 0 {
+				i := op.arg % len(a)
+				a[0], a[i] = a[i], a[0]
+			}
+		}
+	}
+	return string(a)
+}
+
+// A JSEvaluator can call a JavaScript function, given as source code, with a
+// single string argument. There's no JavaScript engine in the standard
+// library, so one must be plugged in to transform n parameters (with
+// DefaultJSEvaluator, or the Eval of a Decipherer or an InfoClient). Without
+// one, n parameters are left as they are, and YouTube throttles downloads
+// from the stream URLs to about real-time speed.
+type JSEvaluator interface {
+	Call(fn, arg string) (string, error)
+}
+
+// DefaultJSEvaluator is the JSEvaluator used by Decipherers and InfoClients
+// which don't have their own. It's nil, so n parameters aren't transformed
+// unless one is plugged in.
+var DefaultJSEvaluator JSEvaluator
+
+var (
+	sigFuncPattern  = regexp.MustCompile(`([a-zA-Z0-9$]+)=function\(\s*(\w)\s*\)\s*\{\s*\w=\w\.split\(""\);(.*?)return \w\.join\(""\)\}`)
+	sigCallPattern  = regexp.MustCompile(`([a-zA-Z0-9$]+)(?:\.([a-zA-Z0-9$]+)|\["([a-zA-Z0-9$]+)"\])\(\w,(\d+)\)`)
+	sigOpPattern    = regexp.MustCompile(`"?([a-zA-Z0-9$]+)"?:function\(\w(?:,\w)?\)\{([^}]*)\}`)
+	nFuncPattern    = regexp.MustCompile(`\.get\("n"\)\)&&\(\w=([a-zA-Z0-9$]+)(?:\[(\d+)\])?\(\w\)`)
+	playerVersionRx = regexp.MustCompile(`player\\?/([0-9a-fA-F]{8})\\?/`)
+)
+
+// ParsePlayer extracts the signature operations and n-function from the
+// source of a player script.
+func ParsePlayer(version, js string) (*Player, error) {
+	p := &Player{Version: version}
+
+	m := sigFuncPattern.FindStringSubmatch(js)
+	if m == nil {
+		return nil, errors.New("signature function not found")
+	}
+	calls := sigCallPattern.FindAllStringSubmatch(m[3], -1)
+	if len(calls) == 0 {
+		return nil, errors.New("no signature operations found")
+	}
+	obj := regexp.MustCompile(`(?s)var ` + regexp.QuoteMeta(calls[0][1]) + `=\{(.*?)\};`).FindStringSubmatch(js)
+	if obj == nil {
+		return nil, fmt.Errorf("signature helper %q not found", calls[0][1])
+	}
+	methods := map[string]string{}
+	for _, def := range sigOpPattern.FindAllStringSubmatch(obj[1], -1) {
+		switch body := def[2]; {
+		case strings.Contains(body, "reverse"):
+			methods[def[1]] = "reverse"
+		case strings.Contains(body, "splice"):
+			methods[def[1]] = "splice"
+		default:
+			methods[def[1]] = "swap"
+		}
+	}
+	for _, call := range calls {
+		name := call[2] + call[3]
+		op, ok := methods[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown signature operation %q", name)
+		}
+		arg, _ := strconv.Atoi(call[4])
+		p.ops = append(p.ops, cipherOp{op, arg})
+	}
+
+	if n := nFuncPattern.FindStringSubmatch(js); n != nil {
+		name := n[1]
+		if n[2] != "" {
+			i, _ := strconv.Atoi(n[2])
+			list := regexp.MustCompile(`var ` + regexp.QuoteMeta(name) + `=\[(.*?)\]`).FindStringSubmatch(js)
+			if list == nil {
+				return nil, fmt.Errorf("n-function list %q not found", name)
+			}
+			names := strings.Split(list[1], ",")
+			if i >= len(names) {
+				return nil, fmt.Errorf("n-function list %q is too short", name)
+			}
+			name = strings.TrimSpace(names[i])
+		}
+		src, err := function(js, name)
+		if err != nil {
+			return nil, err
+		}
+		p.NFunc = src
+	}
+
+	return p, nil
+}
+
+// function extracts the source of the named function from js, by matching
+// the braces of its body (skipping any in string literals).
+func function(js, name string) (string, error) {
+	loc := regexp.MustCompile(`(?:^|[^a-zA-Z0-9$])` + regexp.QuoteMeta(name) + `=function\(`).FindStringIndex(js)
+	if loc == nil {
+		return "", fmt.Errorf("function %q not found", name)
+	}
+	start := strings.Index(js[loc[0]:], "function(") + loc[0]
+	open := strings.IndexByte(js[start:], '{')
+	if open < 0 {
+		return "", fmt.Errorf("function %q has no body", name)
+	}
+	depth := 0
+	var quote byte
+	for i := start + open; i < len(js); i++ {
+		c := js[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				return js[start : i+1], nil
+			}
+		}
+	}
+	return "", fmt.Errorf("function %q is unterminated", name)
+}
+
+// A Decipherer rewrites the stream URLs in video info, deciphering their
+// signatures and transforming their n parameters, using the transforms of
+// the current player. Players are cached by version. The n parameters are
+// only transformed if it has an Eval (or there's a DefaultJSEvaluator);
+// otherwise streams are throttled. A zero Decipherer uses defaults.
+type Decipherer struct {
+	URL  *url.URL
+	HTTP *http.Client
+	Eval JSEvaluator
+
+	mu      sync.Mutex
+	version string
+	checked time.Time
+	players map[string]*Player
+	fetch   *playerFetch
+}
+
+// A playerFetch is a fetch of the current player which is in flight, or has
+// finished (when done is closed), and the number of callers waiting for it.
+type playerFetch struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+	player  *Player
+	err     error
+}
+
+// DefaultDecipherer is the Decipherer used by InfoClients which don't have
+// their own.
+var DefaultDecipherer = new(Decipherer)
+
+// Decipher rewrites the URLs of all of the formats in info. It doesn't fetch
+// the player unless some format needs it.
+func (d *Decipherer) Decipher(info *Info) error {
+	return d.DecipherContext(context.Background(), info)
+}
+
+// DecipherContext is like Decipher, but gives up fetching the player when the
+// context is done.
+func (d *Decipherer) DecipherContext(ctx context.Context, info *Info) error {
+	return d.decipher(ctx, info, d.Eval)
+}
+
+// decipher rewrites the URLs of all of the formats in info, transforming
+// their n parameters with eval (or DefaultJSEvaluator).
+func (d *Decipherer) decipher(ctx context.Context, info *Info, eval JSEvaluator) error {
+	if eval == nil {
+		eval = DefaultJSEvaluator
+	}
+	var urls []*string
+	var ciphers []string
+	for _, f := range info.Formats() {
+		urls = append(urls, &f.URL)
+		ciphers = append(ciphers, f.SignatureCipher)
+	}
+
+	needed := false
+	for i, u := range urls {
+		if ciphers[i] != "" || eval != nil && hasN(*u) {
+			needed = true
+		}
+	}
+	if !needed {
+		return nil
+	}
+
+	p, err := d.PlayerContext(ctx)
+	if err != nil {
+		return err
+	}
+	n := map[string]string{}
+	for i, u := range urls {
+		s, err := rewrite(p, *u, ciphers[i], eval, n)
+		if err != nil {
+			return err
+		}
+		*u = s
+	}
+	return nil
+}
+
+// hasN checks whether the URL s has an n parameter (or can't be parsed, in
+// which case rewrite reports it).
+func hasN(s string) bool {
+	u, err := url.Parse(s)
+	return err != nil || u.Query().Get("n") != ""
+}
+
+// rewrite gets the URL of a format, which may need to be built from its
+// signature cipher, with its n parameter transformed by eval (if it's not
+// nil). Transformed n parameters are memoized in n.
+func rewrite(p *Player, raw, cipher string, eval JSEvaluator, n map[string]string) (string, error) {
+	if cipher != "" {
+		c, err := url.ParseQuery(cipher)
+		if err != nil {
+			return "", err
+		}
+		raw = c.Get("url")
+		sp := c.Get("sp")
+		if sp == "" {
+			sp = "signature"
+		}
+		u, err := url.Parse(raw)
+		if err != nil {
+			return "", err
+		}
+		q := u.Query()
+		q.Set(sp, p.Decipher(c.Get("s")))
+		u.RawQuery = q.Encode()
+		raw = u.String()
+	}
+
+	if eval == nil || p.NFunc == "" {
+		return raw, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	x := q.Get("n")
+	if x == "" {
+		return raw, nil
+	}
+	if _, ok := n[x]; !ok {
+		if n[x], err = eval.Call(p.NFunc, x); err != nil {
+			return "", err
+		}
+	}
+	q.Set("n", n[x])
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Player gets the current player, fetching and parsing it if it isn't
+// cached.
+func (d *Decipherer) Player() (*Player, error) {
+	return d.PlayerContext(context.Background())
+}
+
+// PlayerContext is like Player, but stops waiting for the player when the
+// context is done. Callers which need the player at the same time share a
+// single fetch, which is only abandoned once every caller has stopped
+// waiting for it.
+func (d *Decipherer) PlayerContext(ctx context.Context) (*Player, error) {
+	d.mu.Lock()
+	if d.version != "" && time.Since(d.checked) <= PlayerVersionTTL {
+		if p, ok := d.players[d.version]; ok {
+			d.mu.Unlock()
+			return p, nil
+		}
+	}
+	f := d.fetch
+	if f == nil {
+		fctx, cancel := context.WithCancel(context.Background())
+		f = &playerFetch{done: make(chan struct{}), cancel: cancel}
+		d.fetch = f
+		go func() {
+			f.player, f.err = d.fetchPlayer(fctx)
+			d.mu.Lock()
+			if d.fetch == f {
+				d.fetch = nil
+			}
+			d.mu.Unlock()
+			cancel()
+			close(f.done)
+		}()
+	}
+	f.waiters++
+	d.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.player, f.err
+	case <-ctx.Done():
+		d.mu.Lock()
+		f.waiters--
+		if f.waiters == 0 && d.fetch == f {
+			d.fetch = nil
+			f.cancel()
+		}
+		d.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// fetchPlayer finds the current player version (unless it was found within
+// PlayerVersionTTL), and gets that player, fetching and parsing it if it
+// isn't cached. The Decipherer isn't locked while it's fetching.
+func (d *Decipherer) fetchPlayer(ctx context.Context) (*Player, error) {
+	d.mu.Lock()
+	version, checked := d.version, d.checked
+	d.mu.Unlock()
+	if version == "" || time.Since(checked) > PlayerVersionTTL {
+		body, err := d.get(ctx, d.url())
+		if err != nil {
+			return nil, err
+		}
+		m := playerVersionRx.FindStringSubmatch(body)
+		if m == nil {
+			return nil, errors.New("player version not found")
+		}
+		version = m[1]
+		d.mu.Lock()
+		d.version, d.checked = version, time.Now()
+		d.mu.Unlock()
+	}
+
+	d.mu.Lock()
+	p, ok := d.players[version]
+	d.mu.Unlock()
+	if ok {
+		return p, nil
+	}
+	js, err := d.get(ctx, d.url().ResolveReference(&url.URL{
+		Path: "/s/player/" + version + "/player_ias.vflset/en_US/base.js",
+	}))
+	if err != nil {
+		return nil, err
+	}
+	if p, err = ParsePlayer(version, js); err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	if d.players == nil {
+		d.players = map[string]*Player{}
+	}
+	d.players[version] = p
+	d.mu.Unlock()
+	return p, nil
+}
+
+// url gets the URL from which the Decipherer finds the player version
+func (d *Decipherer) url() *url.URL {
+	if d.URL != nil {
+		return d.URL
+	}
+	return PlayerURL
+}
+
+// get fetches the body of the resource at u
+func (d *Decipherer) get(ctx context.Context, u *url.URL) (string, error) {
+	c := d.HTTP
+	if c == nil {
+		c = DefaultHTTPClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", &StatusError{resp.StatusCode, resp.Status}
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	return string(data), err
+}
+
+func init() {
+	PlayerURL, _ = url.Parse("https://www.youtube.com/iframe_api")
+}
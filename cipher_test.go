@@ -0,0 +1,319 @@
+package yt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testPlayerJS = `var XY={ab:function(a){a.reverse()},
+cd:function(a,b){a.splice(0,b)},
+"ef":function(a,b){var c=a[0];a[0]=a[b%a.length];a[b%a.length]=c}};
+Zz=function(a){a=a.split("");XY.cd(a,1);XY["ab"](a,0);XY.ef(a,2);return a.join("")};
+var Nl=[Nf];
+Nf=function(a){var b=a.split(""),c="}{";return b.reverse().join("")};
+g.x=function(a){(b=a.get("n"))&&(b=Nl[0](b),a.set("n",b))};`
+
+// reverser is a JSEvaluator which reverses its argument
+type reverser struct{ calls int }
+
+func (r *reverser) Call(fn, arg string) (string, error) {
+	r.calls++
+	if !strings.HasPrefix(fn, "function(a){") || !strings.HasSuffix(fn, `reverse().join("")}`) {
+		return "", fmt.Errorf("unexpected function %q", fn)
+	}
+	if arg == "fail" {
+		return "", errors.New("failed")
+	}
+	b := []byte(arg)
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return string(b), nil
+}
+
+func TestParsePlayer(t *testing.T) {
+	p, err := ParsePlayer("1234abcd", testPlayerJS)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if p.Decipher("abcdef") != "defcb" {
+		t.Errorf("expected %q to decipher as %q, got %q", "abcdef", "defcb", p.Decipher("abcdef"))
+	}
+	if p.Decipher("") != "" {
+		t.Errorf("expected an empty signature to stay empty")
+	}
+	if p.NFunc != `function(a){var b=a.split(""),c="}{";return b.reverse().join("")}` {
+		t.Errorf("unexpected n-function %q", p.NFunc)
+	}
+
+	for name, js := range map[string]string{
+		"no signature function": `var x=1;`,
+		"no operations":         `Zz=function(a){a=a.split("");return a.join("")};`,
+		"no helper":             `Zz=function(a){a=a.split("");XY.cd(a,1);return a.join("")};`,
+		"unknown operation":     `var XY={cd:function(a,b){a.splice(0,b)}};Zz=function(a){a=a.split("");XY.zz(a,1);return a.join("")};`,
+		"no n-function list":    strings.Replace(testPlayerJS, "var Nl=[Nf];", "", 1),
+		"short n-function list": strings.Replace(testPlayerJS, "Nl[0]", "Nl[1]", 1),
+		"no n-function":         strings.Replace(testPlayerJS, "Nf=function", "Nx=function", 1),
+		"unterminated":          strings.Replace(testPlayerJS, `join("")};`+"\ng.x", `join("")`, 1),
+		"no body":               `var XY={cd:function(a,b){a.splice(0,b)}};Zz=function(a){a=a.split("");XY.cd(a,1);return a.join("")};(b=a.get("n"))&&(b=Nf(b),a.set("n",b));Nf=function(a)`,
+	} {
+		if _, err := ParsePlayer("x", js); err == nil {
+			t.Errorf("expected an error parsing a player with %s", name)
+		}
+	}
+
+	js := strings.Replace(testPlayerJS, "Nl[0](b)", "Nf(b)", 1)
+	if p, err := ParsePlayer("x", js); err != nil || p.NFunc == "" {
+		t.Errorf("expected to find an unlisted n-function, got %v", err)
+	}
+	js = strings.Replace(testPlayerJS, `(b=a.get("n"))`, `(b=a.get("x"))`, 1)
+	if p, err := ParsePlayer("x", js); err != nil || p.NFunc != "" {
+		t.Errorf("expected no n-function, got %q (%v)", p.NFunc, err)
+	}
+	p = &Player{ops: []cipherOp{{"splice", 10}}}
+	if p.Decipher("abc") != "" {
+		t.Errorf("expected an oversized splice to empty the signature")
+	}
+}
+
+func TestDecipherer(t *testing.T) {
+	var fetches []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches = append(fetches, r.URL.Path)
+		switch r.URL.Path {
+		case "/iframe_api":
+			fmt.Fprint(w, `var scriptUrl = 'https:\/\/www.youtube.com\/s\/player\/1234abcd\/www-widgetapi.vflset\/www-widgetapi.js';`)
+		case "/s/player/1234abcd/player_ias.vflset/en_US/base.js":
+			fmt.Fprint(w, testPlayerJS)
+		case "/unversioned":
+			fmt.Fprint(w, "nothing")
+		case "/stale":
+			fmt.Fprint(w, `/s/player/deadbeef/`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL + "/iframe_api")
+	eval := new(reverser)
+	d := &Decipherer{URL: u, HTTP: ts.Client(), Eval: eval}
+
+	info := new(Info)
+	if err := d.Decipher(info); err != nil || len(fetches) != 0 {
+		t.Errorf("expected nothing to be fetched for info without streams")
+	}
+	info = testCipheredInfo()
+	for _, f := range info.Formats() {
+		f.URL, f.SignatureCipher = "https://example.com/v?mn=sn-abc&sn=x", ""
+	}
+	if err := d.Decipher(info); err != nil || len(fetches) != 0 {
+		t.Errorf("expected nothing to be fetched for streams without n parameters, got %v", fetches)
+	}
+	info = testCipheredInfo()
+	if err := d.Decipher(info); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if x := info.StreamingData.Formats[0].URL; x != "https://example.com/v?n=321&sig=defcb" {
+		t.Errorf("unexpected format URL %q", x)
+	}
+	if x := info.StreamingData.AdaptiveFormats[0].URL; x != "https://example.com/a?n=321&signature=defcb" {
+		t.Errorf("unexpected adaptive format URL %q", x)
+	}
+	if x := info.StreamingData.AdaptiveFormats[1].URL; x != "https://example.com/b?x=1" {
+		t.Errorf("unexpected adaptive format URL %q", x)
+	}
+	if eval.calls != 1 {
+		t.Errorf("expected the n-function to be called once per n, got %d", eval.calls)
+	}
+
+	if err := d.Decipher(testCipheredInfo()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fmt.Sprint(fetches) != "[/iframe_api /s/player/1234abcd/player_ias.vflset/en_US/base.js]" {
+		t.Errorf("expected the player to be fetched once, got %v", fetches)
+	}
+
+	info = testCipheredInfo()
+	info.StreamingData.Formats[0].SignatureCipher = "url=https://example.com/v?n=fail"
+	if err := d.Decipher(info); err == nil {
+		t.Errorf("expected an error from the n-function")
+	}
+	for _, c := range []string{"%zz", "url=%3A"} {
+		info.StreamingData.Formats[0].SignatureCipher = c
+		if err := d.Decipher(info); err == nil {
+			t.Errorf("expected an error deciphering %q", c)
+		}
+	}
+	info.StreamingData.Formats[0].SignatureCipher = ""
+	info.StreamingData.Formats[0].URL = "http://[::1/?n=1"
+	if err := d.Decipher(info); err == nil {
+		t.Errorf("expected an error transforming a bad URL")
+	}
+
+	for _, path := range []string{"/missing", "/unversioned", "/stale"} {
+		u, _ := url.Parse(ts.URL + path)
+		d := &Decipherer{URL: u, HTTP: ts.Client()}
+		if _, err := d.Player(); err == nil {
+			t.Errorf("expected an error getting the player from %s", path)
+		}
+	}
+	if _, err := (&Decipherer{URL: &url.URL{Scheme: "bogus"}}).Player(); err == nil {
+		t.Errorf("expected a transport error")
+	}
+}
+
+func TestDeciphererCoalescing(t *testing.T) {
+	var mu sync.Mutex
+	var fetches []string
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetches = append(fetches, r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/iframe_api":
+			<-release
+			fmt.Fprint(w, `/s/player/1234abcd/`)
+		default:
+			fmt.Fprint(w, testPlayerJS)
+		}
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL + "/iframe_api")
+	d := &Decipherer{URL: u, HTTP: ts.Client()}
+
+	type result struct {
+		p   *Player
+		err error
+	}
+	results := make(chan result)
+	go func() {
+		p, err := d.Player()
+		results <- result{p, err}
+	}()
+	for playerWaiters(d) != 1 {
+		runtime.Gosched()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := d.PlayerContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected to stop waiting for the player when the context is done, got %v", err)
+	}
+	close(release)
+	if r := <-results; r.err != nil || r.p.Version != "1234abcd" {
+		t.Errorf("expected the player, got %v (%v)", r.p, r.err)
+	}
+	if p, err := d.Player(); err != nil || p.Version != "1234abcd" {
+		t.Errorf("expected the cached player, got %v (%v)", p, err)
+	}
+	if fmt.Sprint(fetches) != "[/iframe_api /s/player/1234abcd/player_ias.vflset/en_US/base.js]" {
+		t.Errorf("expected the player to be fetched once, got %v", fetches)
+	}
+}
+
+func TestInfoClientDecipher(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/iframe_api":
+			fmt.Fprint(w, `/s/player/1234abcd/`)
+		default:
+			fmt.Fprint(w, "broken")
+		}
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL + "/iframe_api")
+
+	withInfoServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentTypeJSON)
+		if r.Header.Get("X-YouTube-Client-Name") == "1" {
+			fmt.Fprint(w, `{"videoDetails":{},"streamingData":{"formats":[{"signatureCipher":"s=abc&url=https://example.com/"}]}}`)
+			return
+		}
+		fmt.Fprint(w, `{"videoDetails":{},"streamingData":{"formats":[{"url":"https://example.com/"}]}}`)
+	}), func() {
+		c := &InfoClient{Decipherer: &Decipherer{URL: u, HTTP: ts.Client()}}
+		info, err := c.Get("abcdefghijk")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if x := info.StreamingData.Formats[0].URL; x != "https://example.com/" {
+			t.Errorf("expected to fall back to a profile with plain URLs, got %q", x)
+		}
+	})
+}
+
+func TestInfoClientEval(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/iframe_api":
+			fmt.Fprint(w, `/s/player/1234abcd/`)
+		default:
+			fmt.Fprint(w, testPlayerJS)
+		}
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL + "/iframe_api")
+
+	withInfoServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentTypeJSON)
+		fmt.Fprint(w, `{"videoDetails":{},"streamingData":{"formats":[{"url":"https://example.com/v?n=123"}]}}`)
+	}), func() {
+		d := &Decipherer{URL: u, HTTP: ts.Client()}
+		for _, x := range []struct {
+			c   *InfoClient
+			def JSEvaluator
+			url string
+		}{
+			{&InfoClient{Decipherer: d}, nil, "https://example.com/v?n=123"},
+			{&InfoClient{Decipherer: d, Eval: new(reverser)}, nil, "https://example.com/v?n=321"},
+			{&InfoClient{Decipherer: d}, new(reverser), "https://example.com/v?n=321"},
+		} {
+			DefaultJSEvaluator = x.def
+			info, err := x.c.Get("abcdefghijk")
+			DefaultJSEvaluator = nil
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if u := info.StreamingData.Formats[0].URL; u != x.url {
+				t.Errorf("expected the format URL to be %q, got %q", x.url, u)
+			}
+		}
+	})
+}
+
+func testCipheredInfo() *Info {
+	info := new(Info)
+	data := `{"streamingData":{
+		"formats":[{"signatureCipher":"s=abcdef&sp=sig&url=https%3A%2F%2Fexample.com%2Fv%3Fn%3D123"}],
+		"adaptiveFormats":[
+			{"signatureCipher":"s=abcdef&url=https%3A%2F%2Fexample.com%2Fa%3Fn%3D123"},
+			{"url":"https://example.com/b?x=1"}
+		]
+	}}`
+	if err := json.Unmarshal([]byte(data), info); err != nil {
+		panic(err)
+	}
+	return info
+}
+
+// playerWaiters counts the callers waiting for the Decipherer's fetch of the
+// player
+func playerWaiters(d *Decipherer) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.fetch == nil {
+		return 0
+	}
+	return d.fetch.waiters
+}
@@ -0,0 +1,88 @@
+package yt
+
+import (
+	"context"
+	"sync"
+)
+
+// A CoalescingInfoRepo is an InfoRepo which shares the result of getting
+// info from its Repo among all of the callers which ask for the same ID at
+// the same time, so that only one of them fetches it. The callers share the
+// Info, so they mustn't modify it.
+type CoalescingInfoRepo struct {
+	Repo InfoRepo
+
+	group infoGroup
+}
+
+// Get implements InfoRepo
+func (c *CoalescingInfoRepo) Get(id string) (*Info, error) {
+	return c.GetContext(context.Background(), id)
+}
+
+// GetContext implements InfoRepo. A caller whose context is done stops
+// waiting, but the fetch is only abandoned once every caller has.
+func (c *CoalescingInfoRepo) GetContext(ctx context.Context, id string) (*Info, error) {
+	return c.group.do(ctx, id, func(ctx context.Context) (*Info, error) {
+		return c.Repo.GetContext(ctx, id)
+	})
+}
+
+// An infoGroup coalesces concurrent calls which get info for the same key
+type infoGroup struct {
+	mu    sync.Mutex
+	calls map[string]*infoCall
+}
+
+// An infoCall is a call to get info which is in flight, or has finished
+// (when done is closed), and the number of callers waiting for it.
+type infoCall struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+	info    *Info
+	err     error
+}
+
+// do calls f and returns its results, unless a call with the same key is
+// already in flight, in which case it waits for that call's results instead.
+// Since the call is shared, it gets its own context, which is cancelled if
+// every caller's context is done before it finishes.
+func (g *infoGroup) do(ctx context.Context, key string, f func(context.Context) (*Info, error)) (*Info, error) {
+	g.mu.Lock()
+	c, ok := g.calls[key]
+	if !ok {
+		if g.calls == nil {
+			g.calls = map[string]*infoCall{}
+		}
+		fctx, cancel := context.WithCancel(context.Background())
+		c = &infoCall{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = c
+		go func() {
+			c.info, c.err = f(fctx)
+			g.mu.Lock()
+			if g.calls[key] == c {
+				delete(g.calls, key)
+			}
+			g.mu.Unlock()
+			cancel()
+			close(c.done)
+		}()
+	}
+	c.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.info, c.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 && g.calls[key] == c {
+			delete(g.calls, key)
+			c.cancel()
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,156 @@
+package yt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// A blockingRepo is an InfoRepo which counts its calls, and doesn't return
+// until release is closed
+type blockingRepo struct {
+	calls   int32
+	release chan struct{}
+}
+
+// Get implements InfoRepo
+func (r *blockingRepo) Get(id string) (*Info, error) {
+	return r.GetContext(context.Background(), id)
+}
+
+// GetContext implements InfoRepo
+func (r *blockingRepo) GetContext(ctx context.Context, id string) (*Info, error) {
+	atomic.AddInt32(&r.calls, 1)
+	select {
+	case <-r.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if id == "missing1234" {
+		return nil, errors.New("missing")
+	}
+	return &Info{VideoDetails: &VideoDetails{ID: id}}, nil
+}
+
+func TestCoalescingInfoRepo(t *testing.T) {
+	repo := &blockingRepo{release: make(chan struct{})}
+	c := &CoalescingInfoRepo{Repo: repo}
+	ids := []string{"abcdefghijk", "abcdefghijk", "abcdefghijk", "missing1234", "missing1234"}
+	infos := make([]*Info, len(ids))
+	errs := make([]error, len(ids))
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		go func(i int, id string) {
+			defer wg.Done()
+			infos[i], errs[i] = c.Get(id)
+		}(i, id)
+	}
+	for waiters(&c.group) != len(ids) || atomic.LoadInt32(&repo.calls) != 2 {
+		runtime.Gosched()
+	}
+	close(repo.release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&repo.calls); n != 2 {
+		t.Errorf("expected one fetch per ID, got %d", n)
+	}
+	if infos[0] == nil || infos[0] != infos[1] || infos[1] != infos[2] || errs[0] != nil {
+		t.Errorf("expected the callers to share the info, got %v (%v)", infos[:3], errs[:3])
+	}
+	if errs[3] == nil || errs[3] != errs[4] {
+		t.Errorf("expected the callers to share the error, got %v", errs[3:])
+	}
+
+	if _, err := c.Get("abcdefghijk"); err != nil || atomic.LoadInt32(&repo.calls) != 3 {
+		t.Errorf("expected a later call to fetch again")
+	}
+}
+
+func TestCoalescingInfoRepoCancel(t *testing.T) {
+	repo := &blockingRepo{release: make(chan struct{})}
+	c := &CoalescingInfoRepo{Repo: repo}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error)
+	go func() {
+		_, err := c.GetContext(context.Background(), "abcdefghijk")
+		result <- err
+	}()
+	for atomic.LoadInt32(&repo.calls) == 0 {
+		runtime.Gosched()
+	}
+	cancel()
+	if _, err := c.GetContext(ctx, "abcdefghijk"); err != context.Canceled {
+		t.Errorf("expected a caller whose context is done to give up, got %v", err)
+	}
+	close(repo.release)
+	if err := <-result; err != nil {
+		t.Errorf("expected the fetch to go on for the other caller, got %v", err)
+	}
+
+	repo = &blockingRepo{release: make(chan struct{})}
+	c = &CoalescingInfoRepo{Repo: repo}
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.GetContext(ctx, "abcdefghijk"); err != context.DeadlineExceeded {
+		t.Errorf("expected the deadline to be exceeded, got %v", err)
+	}
+	c.group.mu.Lock()
+	n := len(c.group.calls)
+	c.group.mu.Unlock()
+	if n != 0 {
+		t.Errorf("expected an abandoned fetch to be forgotten")
+	}
+}
+
+func TestHandlerCoalescing(t *testing.T) {
+	var fetches int32
+	release := make(chan struct{})
+	withInfoServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		w.Header().Set("Content-Type", ContentTypeJSON)
+		fmt.Fprint(w, `{"videoDetails":{"videoId":"abcdefgh123"}}`)
+	}), func() {
+		h := new(Handler)
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/abcdefgh123", nil))
+				if w.Code != http.StatusOK {
+					t.Errorf("expected 200, got %d", w.Code)
+				}
+			}()
+		}
+		for waiters(&h.flights) != 10 || atomic.LoadInt32(&fetches) != 1 {
+			runtime.Gosched()
+		}
+		close(release)
+		wg.Wait()
+		if n := atomic.LoadInt32(&fetches); n != 1 {
+			t.Errorf("expected the requests to share one fetch, got %d", n)
+		}
+	})
+}
+
+// waiters counts the callers waiting for the calls in flight in g
+func waiters(g *infoGroup) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	n := 0
+	for _, c := range g.calls {
+		n += c.waiters
+	}
+	return n
+}
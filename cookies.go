@@ -0,0 +1,101 @@
+package yt
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseCookies parses cookies in the Netscape cookies.txt format (as exported
+// by browser extensions, and used by curl and youtube-dl), in which each
+// line has a cookie's domain, whether it applies to subdomains, its path,
+// whether it's secure, its expiry (in Unix time, or 0 for a session cookie),
+// its name and its value, separated by tabs. The Domain of each cookie
+// starts with a dot if (and only if) it applies to subdomains.
+func ParseCookies(r io.Reader) ([]*http.Cookie, error) {
+	var cookies []*http.Cookie
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimRight(s.Text(), "\r")
+		httpOnly := strings.HasPrefix(line, "#HttpOnly_")
+		line = strings.TrimPrefix(line, "#HttpOnly_")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f := strings.Split(line, "\t")
+		if len(f) != 7 {
+			return nil, fmt.Errorf("cookies line %d: expected 7 fields, got %d", n, len(f))
+		}
+		expires, err := strconv.ParseInt(f[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cookies line %d: invalid expiry %q", n, f[4])
+		}
+		c := &http.Cookie{
+			Domain:   strings.TrimPrefix(f[0], "."),
+			Path:     f[2],
+			Secure:   strings.EqualFold(f[3], "TRUE"),
+			Name:     f[5],
+			Value:    f[6],
+			HttpOnly: httpOnly,
+		}
+		if strings.EqualFold(f[1], "TRUE") {
+			c.Domain = "." + c.Domain
+		}
+		if expires > 0 {
+			c.Expires = time.Unix(expires, 0)
+		}
+		cookies = append(cookies, c)
+	}
+	return cookies, s.Err()
+}
+
+// LoadCookies makes a cookie jar from the cookies.txt file with the given
+// name (see ParseCookies). Expired cookies are left out.
+func LoadCookies(name string) (http.CookieJar, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cookies, err := ParseCookies(f)
+	if err != nil {
+		return nil, err
+	}
+	jar, _ := cookiejar.New(nil)
+	for _, c := range cookies {
+		u := &url.URL{Scheme: "http", Host: strings.TrimPrefix(c.Domain, "."), Path: c.Path}
+		if c.Secure {
+			u.Scheme = "https"
+		}
+		if !strings.HasPrefix(c.Domain, ".") {
+			c.Domain = "" // host-only
+		}
+		jar.SetCookies(u, []*http.Cookie{c})
+	}
+	return jar, nil
+}
+
+// sapisidHash gets the Authorization header which YouTube expects (along
+// with the cookies) on requests from a signed-in browser at origin, or ""
+// if the jar has no SAPISID cookie for u.
+func sapisidHash(jar http.CookieJar, u *url.URL, origin string) string {
+	var sapisid string
+	for _, c := range jar.Cookies(u) {
+		if c.Name == "SAPISID" || (c.Name == "__Secure-3PAPISID" && sapisid == "") {
+			sapisid = c.Value
+		}
+	}
+	if sapisid == "" {
+		return ""
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	return fmt.Sprintf("SAPISIDHASH %s_%x", ts, sha1.Sum([]byte(ts+" "+sapisid+" "+origin)))
+}
@@ -0,0 +1,93 @@
+package yt
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testCookies = "# Netscape HTTP Cookie File\r\n" +
+	"\n" +
+	".youtube.com\tTRUE\t/\tTRUE\t4102444800\tSAPISID\tsecret/abc\n" +
+	"#HttpOnly_.youtube.com\tTRUE\t/\tTRUE\t4102444800\tLOGIN_INFO\tlogin\n" +
+	"www.youtube.com\tFALSE\t/\tFALSE\t0\tPREF\thl=en\n" +
+	".youtube.com\tTRUE\t/\tFALSE\t946684800\tEXPIRED\tx\n" +
+	".example.com\tTRUE\t/\tFALSE\t0\tOTHER\ty\n"
+
+func TestParseCookies(t *testing.T) {
+	cookies, err := ParseCookies(strings.NewReader(testCookies))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(cookies) != 5 {
+		t.Fatalf("expected 5 cookies, got %d", len(cookies))
+	}
+	if c := cookies[1]; c.Name != "LOGIN_INFO" || !c.HttpOnly || !c.Secure || c.Domain != ".youtube.com" || c.Expires.Unix() != 4102444800 {
+		t.Errorf("unexpected cookie %+v", c)
+	}
+	if c := cookies[2]; c.Name != "PREF" || c.Value != "hl=en" || c.Secure || c.Domain != "www.youtube.com" || !c.Expires.IsZero() {
+		t.Errorf("unexpected cookie %+v", c)
+	}
+
+	for _, bad := range []string{"a\tb\tc\n", ".youtube.com\tTRUE\t/\tFALSE\tsoon\tA\tb\n"} {
+		if _, err := ParseCookies(strings.NewReader(bad)); err == nil {
+			t.Errorf("expected an error parsing %q", bad)
+		}
+	}
+}
+
+func TestLoadCookies(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "cookies.txt")
+	ioutil.WriteFile(name, []byte(testCookies), 0600)
+
+	jar, err := LoadCookies(name)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for u, expected := range map[string]string{
+		"https://www.youtube.com/youtubei/v1/player": "[SAPISID LOGIN_INFO PREF]",
+		"https://m.youtube.com/":                     "[SAPISID LOGIN_INFO]",
+		"http://www.youtube.com/":                    "[PREF]",
+		"https://www.example.com/":                   "[OTHER]",
+	} {
+		parsed, _ := url.Parse(u)
+		var names []string
+		for _, c := range jar.Cookies(parsed) {
+			names = append(names, c.Name)
+		}
+		if fmt.Sprint(names) != expected {
+			t.Errorf("%s: expected cookies %s, got %v", u, expected, names)
+		}
+	}
+
+	u, _ := url.Parse("https://www.youtube.com/")
+	auth := sapisidHash(jar, u, "https://www.youtube.com")
+	var ts string
+	fmt.Sscanf(auth, "SAPISIDHASH %s", &ts)
+	ts = strings.Split(ts, "_")[0]
+	if expected := fmt.Sprintf("SAPISIDHASH %s_%x", ts, sha1.Sum([]byte(ts+" secret/abc https://www.youtube.com"))); auth != expected {
+		t.Errorf("expected %q, got %q", expected, auth)
+	}
+	u, _ = url.Parse("https://www.example.com/")
+	if auth := sapisidHash(jar, u, "https://www.example.com"); auth != "" {
+		t.Errorf("expected no SAPISIDHASH without a SAPISID, got %q", auth)
+	}
+
+	if _, err := LoadCookies(filepath.Join(dir, "missing.txt")); err == nil {
+		t.Errorf("expected an error loading a missing file")
+	}
+	ioutil.WriteFile(name, []byte("bad\n"), 0600)
+	if _, err := LoadCookies(name); err == nil {
+		t.Errorf("expected an error loading a bad file")
+	}
+}
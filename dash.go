@@ -0,0 +1,127 @@
+package yt
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ContentTypeDASH is the MIME-type of MPEG-DASH manifests
+const ContentTypeDASH = "application/dash+xml"
+
+// An mpd is an MPEG-DASH media presentation description
+type mpd struct {
+	XMLName       xml.Name         `xml:"urn:mpeg:dash:schema:mpd:2011 MPD"`
+	Profiles      string           `xml:"profiles,attr"`
+	Type          string           `xml:"type,attr"`
+	Duration      string           `xml:"mediaPresentationDuration,attr"`
+	MinBufferTime string           `xml:"minBufferTime,attr"`
+	Sets          []*adaptationSet `xml:"Period>AdaptationSet"`
+}
+
+// An adaptationSet groups the interchangeable representations of a stream
+type adaptationSet struct {
+	ID                  int               `xml:"id,attr"`
+	ContentType         string            `xml:"contentType,attr"`
+	MIMEType            string            `xml:"mimeType,attr"`
+	SubsegmentAlignment bool              `xml:"subsegmentAlignment,attr"`
+	Representations     []*representation `xml:"Representation"`
+}
+
+// A representation is a single format in an adaptationSet
+type representation struct {
+	ID                string         `xml:"id,attr"`
+	Codecs            string         `xml:"codecs,attr"`
+	Bandwidth         int            `xml:"bandwidth,attr"`
+	Width             int            `xml:"width,attr,omitempty"`
+	Height            int            `xml:"height,attr,omitempty"`
+	FrameRate         int            `xml:"frameRate,attr,omitempty"`
+	AudioSamplingRate int            `xml:"audioSamplingRate,attr,omitempty"`
+	AudioChannels     *audioChannels `xml:"AudioChannelConfiguration"`
+	BaseURL           string         `xml:"BaseURL"`
+	SegmentBase       struct {
+		IndexRange     string `xml:"indexRange,attr"`
+		Initialization struct {
+			Range string `xml:"range,attr"`
+		} `xml:"Initialization"`
+	} `xml:"SegmentBase"`
+}
+
+// audioChannels describes the number of channels of an audio representation
+type audioChannels struct {
+	Scheme string `xml:"schemeIdUri,attr"`
+	Value  int    `xml:"value,attr"`
+}
+
+// DASHManifest builds an MPEG-DASH manifest (an MPD) for the info's adaptive
+// formats, with an adaptation set for each of their kinds and MIME-types.
+// Formats without the byte ranges of their initialization and index are
+// left out.
+func (i *Info) DASHManifest() ([]byte, error) {
+	m := &mpd{
+		Profiles:      "urn:mpeg:dash:profile:isoff-on-demand:2011",
+		Type:          "static",
+		MinBufferTime: "PT1.5S",
+	}
+	var duration time.Duration
+	if i.VideoDetails != nil {
+		duration = i.VideoDetails.Duration()
+	}
+
+	sets := map[string]*adaptationSet{}
+	if i.StreamingData != nil {
+		for _, f := range i.StreamingData.AdaptiveFormats {
+			if f.URL == "" || f.InitRange == nil || f.IndexRange == nil || f.IsVideo() == f.IsAudio() {
+				continue
+			}
+			if f.ApproxDuration > duration {
+				duration = f.ApproxDuration
+			}
+			kind := "video"
+			if f.IsAudio() {
+				kind = "audio"
+			}
+			mimeType := kind + "/" + f.Container
+			s, ok := sets[mimeType]
+			if !ok {
+				s = &adaptationSet{ID: len(m.Sets), ContentType: kind, MIMEType: mimeType, SubsegmentAlignment: true}
+				sets[mimeType] = s
+				m.Sets = append(m.Sets, s)
+			}
+			s.Representations = append(s.Representations, newRepresentation(f))
+		}
+	}
+	if len(m.Sets) == 0 {
+		return nil, fmt.Errorf("%w with DASH segments", ErrNoFormat)
+	}
+	m.Duration = fmt.Sprintf("PT%sS", strconv.FormatFloat(duration.Seconds(), 'f', -1, 64))
+
+	data, err := xml.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// newRepresentation builds a DASH representation of an adaptive format
+func newRepresentation(f *Format) *representation {
+	r := &representation{
+		ID:        strconv.Itoa(f.ITag),
+		Codecs:    strings.Join(f.Codecs, ","),
+		Bandwidth: f.Bitrate,
+		BaseURL:   f.URL,
+	}
+	if f.IsVideo() {
+		r.Width, r.Height, r.FrameRate = f.Width, f.Height, f.FPS
+	} else {
+		r.AudioSamplingRate = f.AudioSampleRate
+		if f.AudioChannels > 0 {
+			r.AudioChannels = &audioChannels{"urn:mpeg:dash:23003:3:audio_channel_configuration:2011", f.AudioChannels}
+		}
+	}
+	r.SegmentBase.IndexRange = fmt.Sprintf("%d-%d", f.IndexRange.Start, f.IndexRange.End)
+	r.SegmentBase.Initialization.Range = fmt.Sprintf("%d-%d", f.InitRange.Start, f.InitRange.End)
+	return r
+}
@@ -0,0 +1,76 @@
+package yt
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestDASHManifest(t *testing.T) {
+	info := new(Info)
+	data := `{"videoDetails":{"lengthSeconds":"213"},"streamingData":{"adaptiveFormats":[
+		{"itag":137,"url":"https://x/137","mimeType":"video/mp4; codecs=\"avc1.640028\"","width":1920,"height":1080,"fps":30,"bitrate":4000000,"initRange":{"start":"0","end":"740"},"indexRange":{"start":"741","end":"1236"},"approxDurationMs":"213080"},
+		{"itag":248,"url":"https://x/248","mimeType":"video/webm; codecs=\"vp9\"","width":1920,"height":1080,"fps":30,"bitrate":3000000,"initRange":{"start":"0","end":"219"},"indexRange":{"start":"220","end":"951"}},
+		{"itag":136,"url":"https://x/136","mimeType":"video/mp4; codecs=\"avc1.4d401f\"","width":1280,"height":720,"fps":30,"bitrate":2000000,"initRange":{"start":"0","end":"739"},"indexRange":{"start":"740","end":"1235"}},
+		{"itag":140,"url":"https://x/140","mimeType":"audio/mp4; codecs=\"mp4a.40.2\"","bitrate":130000,"audioSampleRate":"44100","audioChannels":2,"initRange":{"start":"0","end":"631"},"indexRange":{"start":"632","end":"927"}},
+		{"itag":141,"url":"https://x/141","mimeType":"audio/mp4; codecs=\"mp4a.40.2\"","bitrate":256000},
+		{"itag":18,"url":"https://x/18","mimeType":"video/mp4; codecs=\"avc1.42001E, mp4a.40.2\"","initRange":{"start":"0","end":"1"},"indexRange":{"start":"2","end":"3"}}
+	]}}`
+	if err := json.Unmarshal([]byte(data), info); err != nil {
+		t.Fatal(err)
+	}
+	b, err := info.DASHManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(b), xml.Header) {
+		t.Errorf("expected an XML header, got %s", b)
+	}
+
+	m := new(mpd)
+	if err := xml.Unmarshal(b, m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Duration != "PT213.08S" {
+		t.Errorf("expected the longest duration, got %q", m.Duration)
+	}
+	if len(m.Sets) != 3 {
+		t.Fatalf("expected 3 adaptation sets, got %d", len(m.Sets))
+	}
+	for i, x := range []struct {
+		mimeType string
+		itags    []string
+	}{
+		{"video/mp4", []string{"137", "136"}},
+		{"video/webm", []string{"248"}},
+		{"audio/mp4", []string{"140"}},
+	} {
+		s := m.Sets[i]
+		if s.MIMEType != x.mimeType || len(s.Representations) != len(x.itags) {
+			t.Errorf("expected set %d to be %s with %v, got %+v", i, x.mimeType, x.itags, s)
+			continue
+		}
+		for j, r := range s.Representations {
+			if r.ID != x.itags[j] {
+				t.Errorf("expected representation %s, got %s", x.itags[j], r.ID)
+			}
+		}
+	}
+	r := m.Sets[0].Representations[0]
+	if r.Codecs != "avc1.640028" || r.Height != 1080 || r.BaseURL != "https://x/137" || r.SegmentBase.IndexRange != "741-1236" || r.SegmentBase.Initialization.Range != "0-740" {
+		t.Errorf("unexpected video representation %+v", r)
+	}
+	r = m.Sets[2].Representations[0]
+	if r.AudioSamplingRate != 44100 || r.AudioChannels == nil || r.AudioChannels.Value != 2 || r.Width != 0 {
+		t.Errorf("unexpected audio representation %+v", r)
+	}
+
+	info.StreamingData.AdaptiveFormats = info.StreamingData.AdaptiveFormats[4:]
+	if _, err := info.DASHManifest(); err == nil {
+		t.Errorf("expected an error without DASH segments")
+	}
+	if _, err := new(Info).DASHManifest(); err == nil {
+		t.Errorf("expected an error without streaming data")
+	}
+}
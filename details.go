@@ -0,0 +1,123 @@
+package yt
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// VideoDetails describes a video whose info has been fetched. Some of the
+// fields (from PublishDate on) come from the player's microformat, rather
+// than its videoDetails.
+type VideoDetails struct {
+	ID               string   `json:"videoId"`
+	Title            string   `json:"title"`
+	LengthSeconds    string   `json:"lengthSeconds"`
+	Keywords         []string `json:"keywords"`
+	ChannelID        string   `json:"channelId"`
+	ShortDescription string   `json:"shortDescription"`
+	Thumbnail        *struct {
+		Thumbnails []*Thumbnail `json:"thumbnails"`
+	} `json:"thumbnail"`
+
+	AverageRating float64 `json:"averageRating"`
+	AllowRatings  bool    `json:"allowRatings"`
+	ViewCount     string  `json:"viewCount"`
+	Author        string  `json:"author"`
+	IsPrivate     bool    `json:"isPrivate"`
+	IsLiveContent bool    `json:"isLiveContent"`
+
+	PublishDate          string                `json:"publishDate,omitempty"`
+	Category             string                `json:"category,omitempty"`
+	IsFamilySafe         bool                  `json:"isFamilySafe"`
+	AvailableCountries   []string              `json:"availableCountries,omitempty"`
+	LiveBroadcastDetails *LiveBroadcastDetails `json:"liveBroadcastDetails,omitempty"`
+}
+
+// LiveBroadcastDetails describes the broadcast of a live video
+type LiveBroadcastDetails struct {
+	IsLiveNow bool      `json:"isLiveNow"`
+	Start     time.Time `json:"startTimestamp"`
+	End       time.Time `json:"endTimestamp"`
+}
+
+// Duration gets the length of the video, or 0 if it's unknown
+func (v *VideoDetails) Duration() time.Duration {
+	s, _ := strconv.ParseInt(v.LengthSeconds, 10, 64)
+	return time.Duration(s) * time.Second
+}
+
+// Views gets the number of times the video has been viewed
+func (v *VideoDetails) Views() int64 {
+	n, _ := strconv.ParseInt(v.ViewCount, 10, 64)
+	return n
+}
+
+// Published gets the date the video was published, or the zero time if it's
+// unknown.
+func (v *VideoDetails) Published() time.Time {
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, v.PublishDate); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// BestThumbnail gets the widest thumbnail which is no wider than maxWidth (or
+// the widest of all, if maxWidth isn't positive). If they're all too wide,
+// it gets the narrowest. It returns nil if there are no thumbnails.
+func (v *VideoDetails) BestThumbnail(maxWidth int) *Thumbnail {
+	if v.Thumbnail == nil {
+		return nil
+	}
+	var best, narrowest *Thumbnail
+	for _, t := range v.Thumbnail.Thumbnails {
+		if narrowest == nil || t.Width < narrowest.Width {
+			narrowest = t
+		}
+		if (maxWidth <= 0 || t.Width <= maxWidth) && (best == nil || t.Width > best.Width) {
+			best = t
+		}
+	}
+	if best == nil {
+		return narrowest
+	}
+	return best
+}
+
+// A microformat holds the details of a video which the player gives outside
+// of its videoDetails.
+type microformat struct {
+	PublishDate          string                `json:"publishDate"`
+	Category             string                `json:"category"`
+	IsFamilySafe         bool                  `json:"isFamilySafe"`
+	AvailableCountries   []string              `json:"availableCountries"`
+	LiveBroadcastDetails *LiveBroadcastDetails `json:"liveBroadcastDetails"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler, copying the details from the
+// player's microformat into VideoDetails.
+func (i *Info) UnmarshalJSON(data []byte) error {
+	type info Info
+	aux := struct {
+		*info
+		Microformat *struct {
+			Renderer *microformat `json:"playerMicroformatRenderer"`
+		} `json:"microformat"`
+	}{info: (*info)(i)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	v := i.VideoDetails
+	if v == nil || aux.Microformat == nil || aux.Microformat.Renderer == nil {
+		return nil
+	}
+	m := aux.Microformat.Renderer
+	v.PublishDate = m.PublishDate
+	v.Category = m.Category
+	v.IsFamilySafe = m.IsFamilySafe
+	v.AvailableCountries = m.AvailableCountries
+	v.LiveBroadcastDetails = m.LiveBroadcastDetails
+	return nil
+}
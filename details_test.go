@@ -0,0 +1,76 @@
+package yt
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+const testDetails = `{
+	"videoDetails":{
+		"videoId":"abcdefghijk","lengthSeconds":"213","viewCount":"1234567890",
+		"thumbnail":{"thumbnails":[
+			{"url":"a","width":168,"height":94},
+			{"url":"b","width":336,"height":188},
+			{"url":"c","width":1920,"height":1080}
+		]}
+	},
+	"microformat":{"playerMicroformatRenderer":{
+		"publishDate":"2023-07-28T05:00:10-07:00","category":"Music","isFamilySafe":true,
+		"availableCountries":["IE","GB"],
+		"liveBroadcastDetails":{"isLiveNow":false,"startTimestamp":"2023-07-28T12:00:00+00:00","endTimestamp":"2023-07-28T13:30:00+00:00"}
+	}}
+}`
+
+func TestVideoDetails(t *testing.T) {
+	info := new(Info)
+	if err := json.Unmarshal([]byte(testDetails), info); err != nil {
+		t.Fatal(err)
+	}
+	v := info.VideoDetails
+	if d := v.Duration(); d != 213*time.Second {
+		t.Errorf("expected a duration of 3m33s, got %s", d)
+	}
+	if n := v.Views(); n != 1234567890 {
+		t.Errorf("expected 1234567890 views, got %d", n)
+	}
+	if p := v.Published(); !p.Equal(time.Date(2023, 7, 28, 12, 0, 10, 0, time.UTC)) {
+		t.Errorf("expected it to be published at 12:00:10 UTC, got %s", p)
+	}
+	if v.Category != "Music" || !v.IsFamilySafe || len(v.AvailableCountries) != 2 {
+		t.Errorf("expected the microformat details, got %+v", v)
+	}
+	if l := v.LiveBroadcastDetails; l == nil || l.IsLiveNow || l.End.Sub(l.Start) != 90*time.Minute {
+		t.Errorf("expected a 90 minute broadcast, got %+v", l)
+	}
+
+	for w, x := range map[int]string{0: "c", 400: "b", 168: "a", 100: "a"} {
+		if th := v.BestThumbnail(w); th == nil || th.URL != x {
+			t.Errorf("expected the best thumbnail up to %d wide to be %q, got %+v", w, x, th)
+		}
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again := new(Info)
+	if err := json.Unmarshal(data, again); err != nil {
+		t.Fatal(err)
+	}
+	if again.VideoDetails.Category != "Music" {
+		t.Errorf("expected the details to survive a round-trip, got %s", data)
+	}
+
+	v = new(VideoDetails)
+	if v.Duration() != 0 || v.Views() != 0 || !v.Published().IsZero() || v.BestThumbnail(0) != nil {
+		t.Errorf("expected empty details to have zero values")
+	}
+	v.PublishDate = "2023-07-28"
+	if p := v.Published(); !p.Equal(time.Date(2023, 7, 28, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected a date-only publish date to parse, got %s", p)
+	}
+	if err := json.Unmarshal([]byte(`{"microformat":[]}`), new(Info)); err == nil {
+		t.Errorf("expected an error unmarshalling a bad microformat")
+	}
+}
@@ -0,0 +1,355 @@
+package yt
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultChunkSize is the size of the byte ranges a Downloader requests when
+// it doesn't specify one; longer requests are throttled.
+const DefaultChunkSize = 10 << 20
+
+// DefaultSegmentSize is the largest segment a Downloader splits streams into
+// for parallel downloads, when it doesn't specify a SegmentSize. Smaller
+// streams are split into a segment per worker.
+const DefaultSegmentSize = 4 * DefaultChunkSize
+
+// DefaultRetries is how many times a Downloader retries a failed segment,
+// when it doesn't specify Retries.
+const DefaultRetries = 3
+
+// A Downloader fetches media streams, chunk by chunk. A zero Downloader uses
+// defaults. If Progress is set, it's called as data is written, with the
+// number of bytes written so far and the total (or -1, if that's unknown).
+//
+// If Workers is more than 1, DownloadFile splits streams of a known length
+// into segments (of SegmentSize, or else at least one per worker), which are
+// fetched concurrently by that many workers; each segment is retried up to
+// Retries times (or DefaultRetries, if it's 0; if it's negative, segments
+// aren't retried).
+type Downloader struct {
+	HTTP        *http.Client
+	ChunkSize   int64
+	Progress    func(written, total int64)
+	Workers     int
+	SegmentSize int64
+	Retries     int
+}
+
+// Download copies the format with the given itag from info to w. It returns
+// the number of bytes written.
+func (d *Downloader) Download(ctx context.Context, info *Info, itag int, w io.Writer) (int64, error) {
+	u, total, err := info.stream(itag)
+	if err != nil {
+		return 0, err
+	}
+	m := &meter{total: total, f: d.Progress}
+	return d.copy(ctx, u, 0, total, &progress{w, m})
+}
+
+// DownloadFile downloads the format with the given itag from info to the
+// named file. If the file already exists, it's assumed to be a partial
+// download, and is resumed. Parallel downloads keep each segment in a file
+// of its own, named after its byte range (like name.part0-1023), until
+// they're all complete; these are resumed too, if the stream is split the
+// same way again (otherwise they're removed once the download is complete).
+func (d *Downloader) DownloadFile(ctx context.Context, info *Info, itag int, name string) error {
+	u, total, err := info.stream(itag)
+	if err != nil {
+		return err
+	}
+	if d.Workers > 1 && total > 0 {
+		return d.downloadSegments(ctx, u, total, name)
+	}
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if total >= 0 && offset > total {
+		return fmt.Errorf("%s is larger than format %d", name, itag)
+	}
+	m := &meter{written: offset, total: total, f: d.Progress}
+	if _, err := d.copy(ctx, u, offset, total, &progress{f, m}); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// downloadSegments downloads the stream at u, which has the given total
+// length, to the named file, in segments which are fetched in parallel.
+func (d *Downloader) downloadSegments(ctx context.Context, u string, total int64, name string) error {
+	if fi, err := os.Stat(name); err == nil && fi.Size() == total {
+		return nil
+	}
+	size := d.SegmentSize
+	if size <= 0 {
+		size = (total + int64(d.Workers) - 1) / int64(d.Workers)
+		if size > DefaultSegmentSize {
+			size = DefaultSegmentSize
+		}
+	}
+	n := int((total + size - 1) / size)
+	m := &meter{total: total, f: d.Progress}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	segments := make(chan int)
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+	for w := 0; w < d.Workers && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range segments {
+				start, end := int64(i)*size, int64(i+1)*size
+				if end > total {
+					end = total
+				}
+				if err := d.segment(ctx, u, start, end, part(name, start, end), m); err != nil {
+					errs <- err
+					cancel()
+				}
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		select {
+		case segments <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(segments)
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for start := int64(0); start < total; start += size {
+		end := start + size
+		if end > total {
+			end = total
+		}
+		if err := appendFile(f, part(name, start, end)); err != nil {
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	removeParts(name)
+	return nil
+}
+
+// segment downloads the bytes of the stream at u from start up to end into
+// the named file, resuming from where it left off (and retrying, if it
+// fails).
+func (d *Downloader) segment(ctx context.Context, u string, start, end int64, name string, m *meter) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if offset > end-start {
+		return fmt.Errorf("%s is larger than its segment", name)
+	}
+	m.add(offset)
+
+	retries := d.Retries
+	if retries == 0 {
+		retries = DefaultRetries
+	}
+	for attempt := 0; ; attempt++ {
+		n, err := d.copy(ctx, u, start+offset, end, &progress{f, m})
+		offset += n
+		if err == nil {
+			return f.Close()
+		}
+		if attempt >= retries || ctx.Err() != nil {
+			return err
+		}
+	}
+}
+
+// copy copies the bytes of the stream at u from offset up to end (or to the
+// end of the stream, if end is -1) to w, one chunk at a time. It returns the
+// number of bytes written.
+func (d *Downloader) copy(ctx context.Context, u string, offset, end int64, w *progress) (int64, error) {
+	size := d.ChunkSize
+	if size <= 0 {
+		size = DefaultChunkSize
+	}
+	c := d.HTTP
+	if c == nil {
+		c = DefaultHTTPClient
+	}
+
+	pos := offset
+	for end < 0 || pos < end {
+		last := pos + size - 1
+		if end >= 0 && last >= end {
+			last = end - 1
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return pos - offset, err
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", pos, last))
+
+		resp, err := c.Do(req)
+		if err != nil {
+			return pos - offset, err
+		}
+		switch {
+		case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && end < 0:
+			resp.Body.Close()
+			return pos - offset, nil
+		case resp.StatusCode == http.StatusOK && pos == 0 && (end < 0 || end == resp.ContentLength):
+			// the whole stream, in one go
+			w.m.setTotal(resp.ContentLength)
+			n, err := io.Copy(w, resp.Body)
+			resp.Body.Close()
+			return n, err
+		case resp.StatusCode != http.StatusPartialContent:
+			resp.Body.Close()
+			return pos - offset, &StatusError{resp.StatusCode, resp.Status}
+		}
+		if end < 0 {
+			end = contentRangeTotal(resp.Header.Get("Content-Range"))
+			w.m.setTotal(end)
+		}
+		n, err := io.Copy(w, resp.Body)
+		resp.Body.Close()
+		pos += n
+		if err != nil {
+			return pos - offset, err
+		}
+		if n == 0 {
+			return pos - offset, io.ErrUnexpectedEOF
+		}
+	}
+	return pos - offset, nil
+}
+
+// part gets the name of the file which holds the bytes of the named file from
+// start up to end
+func part(name string, start, end int64) string {
+	return fmt.Sprintf("%s.part%d-%d", name, start, end-1)
+}
+
+// removeParts removes the segment files of the named file, including any
+// left by a download which split it differently
+func removeParts(name string) {
+	dir, base := filepath.Split(name)
+	if dir == "" {
+		dir = "."
+	}
+	files, _ := ioutil.ReadDir(dir)
+	for _, f := range files {
+		if strings.HasPrefix(f.Name(), base+".part") {
+			os.Remove(filepath.Join(dir, f.Name()))
+		}
+	}
+}
+
+// appendFile copies the contents of the named file to w
+func appendFile(w io.Writer, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// contentRangeTotal gets the complete length from a Content-Range header, or
+// -1 if it's unknown.
+func contentRangeTotal(s string) int64 {
+	i := strings.LastIndexByte(s, '/')
+	if i < 0 {
+		return -1
+	}
+	n, err := strconv.ParseInt(s[i+1:], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// A meter counts the bytes written by a download (which may be spread across
+// several writers), and reports them to a progress function.
+type meter struct {
+	mu             sync.Mutex
+	written, total int64
+	f              func(written, total int64)
+}
+
+// add counts n more bytes as written, and reports them
+func (m *meter) add(n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.written += n
+	if m.f != nil {
+		m.f(m.written, m.total)
+	}
+}
+
+// setTotal sets the total, once it becomes known
+func (m *meter) setTotal(total int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.total = total
+}
+
+// A progress is an io.Writer which counts what's written to its underlying
+// io.Writer with a meter.
+type progress struct {
+	w io.Writer
+	m *meter
+}
+
+// Write implements io.Writer
+func (p *progress) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.m.add(int64(n))
+	return n, err
+}
+
+// stream gets the URL and size (or -1, if it's unknown) of the format with
+// the given itag.
+func (i *Info) stream(itag int) (string, int64, error) {
+	f := i.Format(itag)
+	if f == nil || f.URL == "" {
+		return "", 0, fmt.Errorf("%w with itag %d", ErrNoFormat, itag)
+	}
+	if f.ContentLength <= 0 {
+		return f.URL, -1, nil
+	}
+	return f.URL, f.ContentLength, nil
+}
@@ -0,0 +1,303 @@
+package yt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testStream = "The quick brown fox jumps over the lazy dog"
+
+func TestDownloader(t *testing.T) {
+	var ranges []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		switch r.URL.Path {
+		case "/whole":
+			w.Write([]byte(testStream))
+		case "/fail":
+			w.WriteHeader(http.StatusForbidden)
+		case "/empty":
+			w.Header().Set("Content-Range", "bytes */*")
+			w.WriteHeader(http.StatusPartialContent)
+		default:
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader(testStream))
+		}
+	}))
+	defer ts.Close()
+	info := testStreamInfo(ts.URL)
+
+	var reports []string
+	d := &Downloader{HTTP: ts.Client(), ChunkSize: 16, Progress: func(written, total int64) {
+		reports = append(reports, fmt.Sprintf("%d/%d", written, total))
+	}}
+	b := new(bytes.Buffer)
+	n, err := d.Download(context.Background(), info, 18, b)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if n != int64(len(testStream)) || b.String() != testStream {
+		t.Errorf("expected %q, got %q (%d)", testStream, b.String(), n)
+	}
+	if fmt.Sprint(ranges) != "[bytes=0-15 bytes=16-31 bytes=32-42]" {
+		t.Errorf("expected the stream in chunks, got %v", ranges)
+	}
+	if fmt.Sprint(reports) != "[16/43 32/43 43/43]" {
+		t.Errorf("unexpected progress reports %v", reports)
+	}
+
+	// unknown length, learned from the Content-Range
+	ranges, b = nil, new(bytes.Buffer)
+	d.Progress = nil
+	if _, err := d.Download(context.Background(), info, 22, b); err != nil || b.String() != testStream {
+		t.Errorf("expected %q, got %q (%v)", testStream, b.String(), err)
+	}
+	if len(ranges) != 3 {
+		t.Errorf("expected 3 chunks, got %v", ranges)
+	}
+
+	// ranges ignored
+	b = new(bytes.Buffer)
+	if _, err := d.Download(context.Background(), info, 137, b); err != nil || b.String() != testStream {
+		t.Errorf("expected %q, got %q (%v)", testStream, b.String(), err)
+	}
+
+	for itag, x := range map[int]string{0: "no format", 140: "status 403", 251: "unexpected EOF", 43: "unsupported protocol", 36: "missing ']'"} {
+		if _, err := d.Download(context.Background(), info, itag, new(bytes.Buffer)); err == nil || !strings.Contains(err.Error(), x) {
+			t.Errorf("expected an error (%s) downloading %d, got %v", x, itag, err)
+		}
+	}
+	if _, err := d.Download(context.Background(), info, 22, errWriter{}); err == nil {
+		t.Errorf("expected a write error")
+	}
+}
+
+func TestDownloadFile(t *testing.T) {
+	var ranges []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(testStream))
+	}))
+	defer ts.Close()
+	info := testStreamInfo(ts.URL)
+	dir, err := ioutil.TempDir("", "yt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "stream")
+	d := &Downloader{HTTP: ts.Client(), ChunkSize: 32}
+
+	if err := ioutil.WriteFile(name, []byte(testStream[:20]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.DownloadFile(context.Background(), info, 18, name); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if data, _ := ioutil.ReadFile(name); string(data) != testStream {
+		t.Errorf("expected the download to be resumed, got %q", data)
+	}
+	if fmt.Sprint(ranges) != "[bytes=20-42]" {
+		t.Errorf("expected only the rest to be fetched, got %v", ranges)
+	}
+
+	// already complete, with an unknown length
+	ranges = nil
+	if err := d.DownloadFile(context.Background(), info, 22, name); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fmt.Sprint(ranges) != "[bytes=43-74]" {
+		t.Errorf("unexpected ranges %v", ranges)
+	}
+
+	ioutil.WriteFile(name, []byte(testStream+testStream), 0644)
+	if err := d.DownloadFile(context.Background(), info, 18, name); err == nil {
+		t.Errorf("expected an error resuming an oversized file")
+	}
+	if err := d.DownloadFile(context.Background(), info, 0, name); err == nil {
+		t.Errorf("expected an error downloading an unknown format")
+	}
+	if err := d.DownloadFile(context.Background(), info, 18, dir); err == nil {
+		t.Errorf("expected an error downloading to a directory")
+	}
+	if err := d.DownloadFile(context.Background(), info, 43, name+"2"); err == nil {
+		t.Errorf("expected a transport error")
+	}
+}
+
+func TestContentRangeTotal(t *testing.T) {
+	for s, n := range map[string]int64{"bytes 0-9/100": 100, "bytes 0-9/*": -1, "": -1} {
+		if x := contentRangeTotal(s); x != n {
+			t.Errorf("expected total of %q to be %d, got %d", s, n, x)
+		}
+	}
+}
+
+// testStreamInfo builds Info with formats served from the given URL
+func testStreamInfo(u string) *Info {
+	info := new(Info)
+	data := fmt.Sprintf(`{"streamingData":{
+		"formats":[
+			{"itag":18,"url":"%[1]s/18","contentLength":"43"},
+			{"itag":137,"url":"%[1]s/whole","contentLength":"43"},
+			{"itag":43,"url":"bogus://x","contentLength":"43"},
+			{"itag":36,"url":"http://[::1","contentLength":"43"}
+		],
+		"adaptiveFormats":[
+			{"itag":22,"url":"%[1]s/22"},
+			{"itag":140,"url":"%[1]s/fail"},
+			{"itag":251,"url":"%[1]s/empty"}
+		]
+	}}`, u)
+	if err := json.Unmarshal([]byte(data), info); err != nil {
+		panic(err)
+	}
+	return info
+}
+
+// An errWriter fails to write
+type errWriter struct{}
+
+func (errWriter) Write([]byte) (int, error) {
+	return 0, os.ErrClosed
+}
+
+func TestDownloadFileSegments(t *testing.T) {
+	var mu sync.Mutex
+	var ranges []string
+	failures := map[string]int{"bytes=10-17": 2}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		rng := r.Header.Get("Range")
+		ranges = append(ranges, rng)
+		fail := failures[rng] > 0
+		failures[rng]--
+		mu.Unlock()
+		if fail || r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(testStream))
+	}))
+	defer ts.Close()
+	info := testStreamInfo(ts.URL)
+	info.StreamingData.AdaptiveFormats[1].ContentLength = 43
+	dir, err := ioutil.TempDir("", "yt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "stream")
+
+	var written, total int64
+	d := &Downloader{HTTP: ts.Client(), ChunkSize: 8, Workers: 3, SegmentSize: 10, Retries: 2, Progress: func(w, t int64) {
+		written, total = w, t
+	}}
+	ioutil.WriteFile(part(name, 40, 43), []byte(testStream[40:42]), 0644)
+	ioutil.WriteFile(part(name, 11, 22), []byte("from another split"), 0644)
+	if err := d.DownloadFile(context.Background(), info, 18, name); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if data, _ := ioutil.ReadFile(name); string(data) != testStream {
+		t.Errorf("expected segments to be reassembled, got %q", data)
+	}
+	if written != 43 || total != 43 {
+		t.Errorf("expected progress to reach 43/43, got %d/%d", written, total)
+	}
+	sort.Strings(ranges)
+	if x := "[bytes=0-7 bytes=10-17 bytes=10-17 bytes=10-17 bytes=18-19 bytes=20-27 bytes=28-29 bytes=30-37 bytes=38-39 bytes=42-42 bytes=8-9]"; fmt.Sprint(ranges) != x {
+		t.Errorf("expected\n%s, got\n%v", x, ranges)
+	}
+	if matches, _ := filepath.Glob(name + ".part*"); len(matches) != 0 {
+		t.Errorf("expected all segment files to be removed, got %v", matches)
+	}
+
+	ranges = nil
+	if err := d.DownloadFile(context.Background(), info, 18, name); err != nil || len(ranges) != 0 {
+		t.Errorf("expected a complete download not to be fetched again (%v, %v)", ranges, err)
+	}
+
+	d.Retries = -1
+	failures["bytes=0-7"] = 1
+	if err := d.DownloadFile(context.Background(), info, 18, name+"2"); err == nil {
+		t.Errorf("expected a segment to fail without retries")
+	}
+	if err := d.DownloadFile(context.Background(), info, 140, name+"3"); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("expected segments to fail, got %v", err)
+	}
+
+	ioutil.WriteFile(part(name+"4", 0, 10), []byte(testStream), 0644)
+	if err := d.DownloadFile(context.Background(), info, 18, name+"4"); err == nil {
+		t.Errorf("expected an error resuming an oversized segment")
+	}
+	os.Mkdir(part(name+"5", 0, 10), 0755)
+	if err := d.DownloadFile(context.Background(), info, 18, name+"5"); err == nil {
+		t.Errorf("expected an error writing a segment to a directory")
+	}
+	if err := d.DownloadFile(context.Background(), info, 18, filepath.Join(name, "x")); err == nil {
+		t.Errorf("expected an error downloading into a file")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := d.DownloadFile(ctx, info, 18, name+"6"); err == nil {
+		t.Errorf("expected a cancelled download to fail")
+	}
+}
+
+func TestDownloadFileWorkers(t *testing.T) {
+	var mu sync.Mutex
+	var ranges []string
+	failures := map[string]int{"bytes=11-21": DefaultRetries}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		rng := r.Header.Get("Range")
+		ranges = append(ranges, rng)
+		fail := failures[rng] > 0
+		failures[rng]--
+		mu.Unlock()
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(testStream))
+	}))
+	defer ts.Close()
+	info := testStreamInfo(ts.URL)
+	info.StreamingData.AdaptiveFormats[1].ContentLength = 43
+	dir, err := ioutil.TempDir("", "yt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "stream")
+
+	d := &Downloader{HTTP: ts.Client(), Workers: 4}
+	if err := d.DownloadFile(context.Background(), info, 18, name); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if data, _ := ioutil.ReadFile(name); string(data) != testStream {
+		t.Errorf("expected segments to be reassembled, got %q", data)
+	}
+	sort.Strings(ranges)
+	if x := "[bytes=0-10 bytes=11-21 bytes=11-21 bytes=11-21 bytes=11-21 bytes=22-32 bytes=33-42]"; fmt.Sprint(ranges) != x {
+		t.Errorf("expected a segment per worker, retried by default\n%s, got\n%v", x, ranges)
+	}
+}
+
+func TestAppendFile(t *testing.T) {
+	if err := appendFile(new(bytes.Buffer), "/nonexistent"); err == nil {
+		t.Errorf("expected an error appending a missing file")
+	}
+}
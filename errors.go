@@ -0,0 +1,216 @@
+package yt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The kinds of failure which callers may want to tell apart, with errors.Is.
+// An UnavailableError is ErrUnavailable, and (depending on why YouTube says
+// the video is unavailable) one of the kinds from ErrPrivate to
+// ErrRateLimited. A StatusError for 429 Too Many Requests is ErrRateLimited,
+// and a MalformedResponseError is ErrMalformedResponse.
+var (
+	ErrUnavailable       = errors.New("video unavailable")
+	ErrPrivate           = errors.New("video is private")
+	ErrAgeRestricted     = errors.New("video is age-restricted")
+	ErrRegionBlocked     = errors.New("video is blocked in this region")
+	ErrRemoved           = errors.New("video has been removed")
+	ErrMembersOnly       = errors.New("video is for channel members only")
+	ErrNotStarted        = errors.New("premiere or live stream hasn't started")
+	ErrLiveEnded         = errors.New("live stream has ended")
+	ErrRateLimited       = errors.New("rate limited")
+	ErrMalformedResponse = errors.New("malformed response")
+)
+
+// An UnavailableError is returned when YouTube refuses to provide info for a
+// video, with the playability status (or errorcode) and reason it gave, any
+// more detailed explanation (Subreason), and, for a premiere or a live
+// stream which hasn't started, when it's scheduled to.
+type UnavailableError struct {
+	Code      string
+	Reason    string
+	Subreason string
+	Start     time.Time
+}
+
+// Error implements error
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("errorcode %s (%s)", e.Code, e.Reason)
+}
+
+// Is lets errors.Is match the error with ErrUnavailable, and with the kind of
+// unavailability described by its code and reasons.
+func (e *UnavailableError) Is(target error) bool {
+	return target == ErrUnavailable || target == e.kind()
+}
+
+// kind classifies the error by its code, or else its reasons, returning nil
+// if it doesn't match any of the known kinds.
+func (e *UnavailableError) kind() error {
+	switch e.Code {
+	case "AGE_CHECK_REQUIRED", "AGE_VERIFICATION_REQUIRED", "CONTENT_CHECK_REQUIRED":
+		return ErrAgeRestricted
+	case "LIVE_STREAM_OFFLINE":
+		return ErrNotStarted
+	}
+	switch {
+	case e.Removed():
+		return ErrRemoved
+	case e.has("private"):
+		return ErrPrivate
+	case e.has("members", "join this channel"):
+		return ErrMembersOnly
+	case e.has("confirm your age", "age-restricted", "inappropriate for some users"):
+		return ErrAgeRestricted
+	case e.has("not a bot", "unusual traffic"):
+		return ErrRateLimited
+	case e.has("country", "region"):
+		return ErrRegionBlocked
+	case e.has("recording is not available", "has ended", "was ended"):
+		return ErrLiveEnded
+	case !e.Start.IsZero() || e.has("premiere", "will begin", "scheduled"):
+		return ErrNotStarted
+	}
+	return nil
+}
+
+// Removed checks whether the reasons indicate that the video is gone for
+// good (rather than private, blocked or never existed).
+func (e *UnavailableError) Removed() bool {
+	return e.has("removed", "terminated")
+}
+
+// has checks whether the reason or subreason contains any of the given
+// (lower case) phrases.
+func (e *UnavailableError) has(phrases ...string) bool {
+	r := strings.ToLower(e.Reason + "\n" + e.Subreason)
+	for _, s := range phrases {
+		if strings.Contains(r, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// A StatusError is returned when a server responds with an unexpected
+// status.
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+// Error implements error
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("response status %d (%s)", e.StatusCode, e.Status)
+}
+
+// Is lets errors.Is match a 429 Too Many Requests with ErrRateLimited
+func (e *StatusError) Is(target error) bool {
+	return target == ErrRateLimited && e.StatusCode == 429
+}
+
+// A MalformedResponseError is returned when a response can't be understood
+type MalformedResponseError struct {
+	Err error
+}
+
+// Error implements error
+func (e *MalformedResponseError) Error() string {
+	return "malformed response: " + e.Err.Error()
+}
+
+// Unwrap gets the underlying error
+func (e *MalformedResponseError) Unwrap() error {
+	return e.Err
+}
+
+// Is lets errors.Is match the error with ErrMalformedResponse
+func (e *MalformedResponseError) Is(target error) bool {
+	return target == ErrMalformedResponse
+}
+
+// A PlayabilityStatus is YouTube's verdict on whether a video can be played,
+// and if not, why not. The Subreason and Start are parsed from the error
+// screen and the live stream's offline slate which YouTube would show.
+type PlayabilityStatus struct {
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason,omitempty"`
+	Messages  []string  `json:"messages,omitempty"`
+	Subreason string    `json:"subreason,omitempty"`
+	Start     time.Time `json:"scheduledStart"`
+}
+
+// Err gets an *UnavailableError describing the status, or nil if it's OK.
+func (p *PlayabilityStatus) Err() error {
+	if p == nil || p.Status == "OK" {
+		return nil
+	}
+	e := &UnavailableError{Code: p.Status, Reason: p.Reason, Subreason: p.Subreason, Start: p.Start}
+	if e.Reason == "" && len(p.Messages) > 0 {
+		e.Reason = p.Messages[0]
+	}
+	return e
+}
+
+// UnmarshalJSON implements json.Unmarshaler, finding the subreason and the
+// scheduled start time in the renderers where YouTube puts them.
+func (p *PlayabilityStatus) UnmarshalJSON(data []byte) error {
+	type status PlayabilityStatus
+	aux := struct {
+		*status
+		ErrorScreen *struct {
+			PlayerErrorMessageRenderer *struct {
+				Subreason *formattedText `json:"subreason"`
+			} `json:"playerErrorMessageRenderer"`
+		} `json:"errorScreen"`
+		LiveStreamability *struct {
+			LiveStreamabilityRenderer *struct {
+				OfflineSlate *struct {
+					LiveStreamOfflineSlateRenderer *struct {
+						ScheduledStartTime string `json:"scheduledStartTime"`
+					} `json:"liveStreamOfflineSlateRenderer"`
+				} `json:"offlineSlate"`
+			} `json:"liveStreamabilityRenderer"`
+		} `json:"liveStreamability"`
+	}{status: (*status)(p)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if s := aux.ErrorScreen; s != nil && s.PlayerErrorMessageRenderer != nil && s.PlayerErrorMessageRenderer.Subreason != nil {
+		p.Subreason = s.PlayerErrorMessageRenderer.Subreason.String()
+	}
+	if l := aux.LiveStreamability; l != nil && l.LiveStreamabilityRenderer != nil && l.LiveStreamabilityRenderer.OfflineSlate != nil {
+		if r := l.LiveStreamabilityRenderer.OfflineSlate.LiveStreamOfflineSlateRenderer; r != nil {
+			if s, err := strconv.ParseInt(r.ScheduledStartTime, 10, 64); err == nil {
+				p.Start = time.Unix(s, 0).UTC()
+			}
+		}
+	}
+	return nil
+}
+
+// A formattedText is a piece of text in YouTube's renderers, which is either
+// simple, or made up of runs.
+type formattedText struct {
+	SimpleText string `json:"simpleText"`
+	Runs       []struct {
+		Text string `json:"text"`
+	} `json:"runs"`
+}
+
+// String implements fmt.Stringer
+func (t *formattedText) String() string {
+	if t.SimpleText != "" {
+		return t.SimpleText
+	}
+	var b strings.Builder
+	for _, r := range t.Runs {
+		b.WriteString(r.Text)
+	}
+	return b.String()
+}
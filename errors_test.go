@@ -0,0 +1,117 @@
+package yt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestUnavailableErrorKinds(t *testing.T) {
+	for _, tc := range []struct {
+		err  *UnavailableError
+		kind error
+	}{
+		{&UnavailableError{Code: "ERROR", Reason: "This video has been removed by the uploader"}, ErrRemoved},
+		{&UnavailableError{Code: "ERROR", Reason: "This video is no longer available because the YouTube account associated with this video has been terminated."}, ErrRemoved},
+		{&UnavailableError{Code: "LOGIN_REQUIRED", Reason: "This video is private"}, ErrPrivate},
+		{&UnavailableError{Code: "LOGIN_REQUIRED", Reason: "Sign in to confirm your age"}, ErrAgeRestricted},
+		{&UnavailableError{Code: "UNPLAYABLE", Reason: "Video unavailable", Subreason: "The uploader has not made this video available in your country"}, ErrRegionBlocked},
+		{&UnavailableError{Code: "UNPLAYABLE", Reason: "Join this channel to get access to members-only content like this video, and other exclusive perks."}, ErrMembersOnly},
+		{&UnavailableError{Code: "LIVE_STREAM_OFFLINE", Reason: "Premieres in 2 hours"}, ErrNotStarted},
+		{&UnavailableError{Code: "UNPLAYABLE", Reason: "Scheduled", Start: time.Unix(1700000000, 0)}, ErrNotStarted},
+		{&UnavailableError{Code: "UNPLAYABLE", Reason: "This live stream recording is not available."}, ErrLiveEnded},
+		{&UnavailableError{Code: "LOGIN_REQUIRED", Reason: "Sign in to confirm you’re not a bot"}, ErrRateLimited},
+		{&UnavailableError{Code: "ERROR", Reason: "Video unavailable", Subreason: "This video is no longer available because the YouTube account associated with this video has been terminated."}, ErrRemoved},
+		{&UnavailableError{Code: "AGE_CHECK_REQUIRED", Reason: "Video unavailable"}, ErrAgeRestricted},
+		{&UnavailableError{Code: "AGE_VERIFICATION_REQUIRED", Reason: "Video unavailable"}, ErrAgeRestricted},
+		{&UnavailableError{Code: "CONTENT_CHECK_REQUIRED", Reason: "The following content may contain suicide or self-harm topics."}, ErrAgeRestricted},
+		{&UnavailableError{Code: "ERROR", Reason: "Video unavailable"}, nil},
+	} {
+		if !errors.Is(tc.err, ErrUnavailable) {
+			t.Errorf("expected %v to be ErrUnavailable", tc.err)
+		}
+		if tc.err.kind() != tc.kind {
+			t.Errorf("expected %v to be %v, got %v", tc.err, tc.kind, tc.err.kind())
+		}
+		wrapped := fmt.Errorf("getting info: %w", tc.err)
+		if tc.kind != nil && !errors.Is(wrapped, tc.kind) {
+			t.Errorf("expected the wrapped %v to be %v", tc.err, tc.kind)
+		}
+		if errors.Is(wrapped, ErrMalformedResponse) {
+			t.Errorf("expected %v not to be a malformed response", tc.err)
+		}
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	err := error(&StatusError{http.StatusTooManyRequests, "429 Too Many Requests"})
+	if err.Error() != "response status 429 (429 Too Many Requests)" {
+		t.Errorf("unexpected error message %q", err.Error())
+	}
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("expected a 429 to be rate limited")
+	}
+	var s *StatusError
+	if !errors.As(fmt.Errorf("fetching: %w", err), &s) || s.StatusCode != 429 {
+		t.Errorf("expected a StatusError, got %v", s)
+	}
+	if errors.Is(&StatusError{http.StatusInternalServerError, "500"}, ErrRateLimited) {
+		t.Errorf("expected a 500 not to be rate limited")
+	}
+
+	err = &MalformedResponseError{io.ErrUnexpectedEOF}
+	if err.Error() != "malformed response: unexpected EOF" {
+		t.Errorf("unexpected error message %q", err.Error())
+	}
+	if !errors.Is(err, ErrMalformedResponse) || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected the error to be ErrMalformedResponse and what it wraps")
+	}
+}
+
+func TestPlayabilityStatus(t *testing.T) {
+	var ps *PlayabilityStatus
+	if ps.Err() != nil {
+		t.Errorf("expected no error for a missing status")
+	}
+	for _, tc := range []struct {
+		json string
+		err  *UnavailableError
+	}{
+		{`{"status":"OK"}`, nil},
+		{`{"status":"ERROR","messages":["Video unavailable"]}`, &UnavailableError{Code: "ERROR", Reason: "Video unavailable"}},
+		{`{"status":"UNPLAYABLE","reason":"Video unavailable","errorScreen":{"playerErrorMessageRenderer":{"subreason":{"runs":[{"text":"Not available "},{"text":"in your country"}]}}}}`,
+			&UnavailableError{Code: "UNPLAYABLE", Reason: "Video unavailable", Subreason: "Not available in your country"}},
+		{`{"status":"UNPLAYABLE","reason":"Video unavailable","errorScreen":{"playerErrorMessageRenderer":{"subreason":{"simpleText":"Private"}}}}`,
+			&UnavailableError{Code: "UNPLAYABLE", Reason: "Video unavailable", Subreason: "Private"}},
+		{`{"status":"LIVE_STREAM_OFFLINE","reason":"Premieres soon","liveStreamability":{"liveStreamabilityRenderer":{"offlineSlate":{"liveStreamOfflineSlateRenderer":{"scheduledStartTime":"1700000000"}}}}}`,
+			&UnavailableError{Code: "LIVE_STREAM_OFFLINE", Reason: "Premieres soon", Start: time.Unix(1700000000, 0).UTC()}},
+	} {
+		ps := new(PlayabilityStatus)
+		if err := json.Unmarshal([]byte(tc.json), ps); err != nil {
+			t.Fatalf("%s: expected no error, got %v", tc.json, err)
+		}
+		err := ps.Err()
+		if tc.err == nil {
+			if err != nil {
+				t.Errorf("%s: expected no error, got %v", tc.json, err)
+			}
+			continue
+		}
+		if u, ok := err.(*UnavailableError); !ok || *u != *tc.err {
+			t.Errorf("%s: expected %#v, got %#v", tc.json, tc.err, err)
+		}
+
+		data, _ := json.Marshal(ps)
+		again := new(PlayabilityStatus)
+		if err := json.Unmarshal(data, again); err != nil || again.Subreason != ps.Subreason || !again.Start.Equal(ps.Start) {
+			t.Errorf("expected %s to survive a round trip, got %+v", data, again)
+		}
+	}
+	if err := json.Unmarshal([]byte(`{"status":1}`), new(PlayabilityStatus)); err == nil {
+		t.Errorf("expected an error for a bad status")
+	}
+}
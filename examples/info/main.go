@@ -3,16 +3,24 @@ package main
 import (
 	"fmt"
 	"log"
+	"os"
 
 	"github.com/bjjb/yt"
 )
 
 func main() {
-	info, err := yt.GetInfo("aqz-KE-bpKQ")
+	id := "aqz-KE-bpKQ"
+	if len(os.Args) > 1 {
+		id = os.Args[1] // a video ID, or any video URL
+	}
+	info, err := yt.GetInfo(id)
 	if err != nil {
 		log.Fatal(err)
 	}
 	fmt.Println(info.VideoDetails.Title)
+	if info.StreamingData == nil || len(info.StreamingData.Formats) == 0 {
+		log.Fatal("no formats")
+	}
 	fmt.Println(info.StreamingData.Formats[0].URL)
 	fmt.Printf("Expires in %s seconds\n", info.StreamingData.ExpiresInSeconds)
 }
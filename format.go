@@ -0,0 +1,158 @@
+package yt
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Format is a stream of a video, in one of the formats in which it's
+// available; it may have video, audio or both. Numbers which YouTube encodes
+// as strings are parsed, and the MIME-type is broken into its container and
+// codecs.
+type Format struct {
+	ITag            int           `json:"itag"`
+	URL             string        `json:"url,omitempty"`
+	SignatureCipher string        `json:"signatureCipher,omitempty"`
+	MIMEType        string        `json:"mimeType"`
+	Container       string        `json:"-"`
+	Codecs          []string      `json:"-"`
+	Bitrate         int           `json:"bitrate"`
+	AverageBitrate  int           `json:"averageBitrate,omitempty"`
+	Width           int           `json:"width,omitempty"`
+	Height          int           `json:"height,omitempty"`
+	FPS             int           `json:"fps,omitempty"`
+	Quality         string        `json:"quality,omitempty"`
+	QualityLabel    string        `json:"qualityLabel,omitempty"`
+	ProjectionType  string        `json:"projectionType,omitempty"`
+	InitRange       *Range        `json:"initRange,omitempty"`
+	IndexRange      *Range        `json:"indexRange,omitempty"`
+	LastModified    time.Time     `json:"-"`
+	ContentLength   int64         `json:"contentLength,string,omitempty"`
+	ApproxDuration  time.Duration `json:"-"`
+	AudioQuality    string        `json:"audioQuality,omitempty"`
+	AudioSampleRate int           `json:"audioSampleRate,string,omitempty"`
+	AudioChannels   int           `json:"audioChannels,omitempty"`
+}
+
+// ErrNoFormat is returned (wrapped) when a video has no format which will do
+var ErrNoFormat = errors.New("no format")
+
+// A Range is an inclusive range of bytes within a stream
+type Range struct {
+	Start int64 `json:"start,string"`
+	End   int64 `json:"end,string"`
+}
+
+// IsVideo checks whether the format has video
+func (f *Format) IsVideo() bool {
+	return strings.HasPrefix(f.MIMEType, "video/")
+}
+
+// IsAudio checks whether the format has audio; either it's an audio format,
+// or a video format with a second (audio) codec.
+func (f *Format) IsAudio() bool {
+	return strings.HasPrefix(f.MIMEType, "audio/") || f.IsVideo() && len(f.Codecs) > 1
+}
+
+// VideoCodec gets the codec of the format's video, if it has any
+func (f *Format) VideoCodec() string {
+	if f.IsVideo() && len(f.Codecs) > 0 {
+		return f.Codecs[0]
+	}
+	return ""
+}
+
+// AudioCodec gets the codec of the format's audio, if it has any
+func (f *Format) AudioCodec() string {
+	if !f.IsAudio() || len(f.Codecs) == 0 {
+		return ""
+	}
+	return f.Codecs[len(f.Codecs)-1]
+}
+
+// formatJSON holds the fields of a Format which need converting to and from
+// YouTube's JSON.
+type formatJSON struct {
+	LastModifiedUS   string `json:"lastModified,omitempty"`
+	ApproxDurationMS string `json:"approxDurationMs,omitempty"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (f *Format) UnmarshalJSON(data []byte) error {
+	type format Format
+	aux := struct {
+		*format
+		formatJSON
+	}{format: (*format)(f)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if s := aux.LastModifiedUS; s != "" {
+		us, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.LastModified = time.Unix(0, us*int64(time.Microsecond)).UTC()
+	}
+	if s := aux.ApproxDurationMS; s != "" {
+		ms, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.ApproxDuration = time.Duration(ms) * time.Millisecond
+	}
+	f.Container, f.Codecs = "", nil
+	if t, params, err := mime.ParseMediaType(f.MIMEType); err == nil {
+		if i := strings.IndexByte(t, '/'); i >= 0 {
+			f.Container = t[i+1:]
+		}
+		for _, c := range strings.Split(params["codecs"], ",") {
+			if c = strings.TrimSpace(c); c != "" {
+				f.Codecs = append(f.Codecs, c)
+			}
+		}
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler
+func (f *Format) MarshalJSON() ([]byte, error) {
+	type format Format
+	aux := struct {
+		*format
+		formatJSON
+	}{format: (*format)(f)}
+	if !f.LastModified.IsZero() {
+		aux.LastModifiedUS = strconv.FormatInt(f.LastModified.UnixNano()/int64(time.Microsecond), 10)
+	}
+	if f.ApproxDuration != 0 {
+		aux.ApproxDurationMS = strconv.FormatInt(int64(f.ApproxDuration/time.Millisecond), 10)
+	}
+	return json.Marshal(aux)
+}
+
+// Formats gets all of the info's formats; the muxed ones (with both video and
+// audio) first, then the adaptive ones.
+func (i *Info) Formats() []*Format {
+	if i.StreamingData == nil {
+		return nil
+	}
+	var fs []*Format
+	fs = append(fs, i.StreamingData.Formats...)
+	return append(fs, i.StreamingData.AdaptiveFormats...)
+}
+
+// Format gets the format with the given itag, or nil if there's no such
+// format.
+func (i *Info) Format(itag int) *Format {
+	for _, f := range i.Formats() {
+		if f.ITag == itag {
+			return f
+		}
+	}
+	return nil
+}
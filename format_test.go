@@ -0,0 +1,102 @@
+package yt
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testFormatJSON = `{"itag":251,"url":"https://x/y","mimeType":"audio/webm; codecs=\"opus\"","bitrate":160000,"initRange":{"start":"0","end":"265"},"indexRange":{"start":"266","end":"900"},"lastModified":"1690000000123456","contentLength":"3512345","approxDurationMs":"213061","audioQuality":"AUDIO_QUALITY_MEDIUM","audioSampleRate":"48000","audioChannels":2}`
+
+func TestFormatJSON(t *testing.T) {
+	f := new(Format)
+	if err := json.Unmarshal([]byte(testFormatJSON), f); err != nil {
+		t.Fatal(err)
+	}
+	x := &Format{
+		ITag:            251,
+		URL:             "https://x/y",
+		MIMEType:        `audio/webm; codecs="opus"`,
+		Container:       "webm",
+		Codecs:          []string{"opus"},
+		Bitrate:         160000,
+		InitRange:       &Range{0, 265},
+		IndexRange:      &Range{266, 900},
+		LastModified:    time.Unix(1690000000, 123456000).UTC(),
+		ContentLength:   3512345,
+		ApproxDuration:  213061 * time.Millisecond,
+		AudioQuality:    "AUDIO_QUALITY_MEDIUM",
+		AudioSampleRate: 48000,
+		AudioChannels:   2,
+	}
+	if !reflect.DeepEqual(f, x) {
+		t.Fatalf("expected %+v, got %+v", x, f)
+	}
+
+	data, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := new(Format)
+	if err := json.Unmarshal(data, g); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(f, g) {
+		t.Errorf("expected %s to round-trip, got %+v", data, g)
+	}
+
+	for _, s := range []string{
+		`{"lastModified":"x"}`,
+		`{"approxDurationMs":"x"}`,
+		`{"contentLength":"x"}`,
+		`[]`,
+	} {
+		if err := json.Unmarshal([]byte(s), new(Format)); err == nil {
+			t.Errorf("expected an error unmarshalling %s", s)
+		}
+	}
+}
+
+func TestFormatCodecs(t *testing.T) {
+	for mimeType, x := range map[string]struct {
+		video, audio   bool
+		vcodec, acodec string
+	}{
+		`video/mp4; codecs="avc1.42001E, mp4a.40.2"`: {true, true, "avc1.42001E", "mp4a.40.2"},
+		`video/webm; codecs="vp9"`:                   {true, false, "vp9", ""},
+		`audio/mp4; codecs="mp4a.40.2"`:              {false, true, "", "mp4a.40.2"},
+		`bogus`:                                      {false, false, "", ""},
+	} {
+		f := new(Format)
+		data, _ := json.Marshal(map[string]string{"mimeType": mimeType})
+		if err := json.Unmarshal(data, f); err != nil {
+			t.Fatal(err)
+		}
+		if f.IsVideo() != x.video || f.IsAudio() != x.audio {
+			t.Errorf("expected %q to be video %t and audio %t", mimeType, x.video, x.audio)
+		}
+		if f.VideoCodec() != x.vcodec || f.AudioCodec() != x.acodec {
+			t.Errorf("expected %q to have codecs %q and %q, got %q and %q", mimeType, x.vcodec, x.acodec, f.VideoCodec(), f.AudioCodec())
+		}
+	}
+}
+
+func TestInfoFormats(t *testing.T) {
+	if new(Info).Formats() != nil {
+		t.Errorf("expected no formats without streaming data")
+	}
+	info := new(Info)
+	if err := json.Unmarshal([]byte(testFormats), info); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(info.Formats()); n != 10 {
+		t.Errorf("expected 10 formats, got %d", n)
+	}
+	if f := info.Format(140); f == nil || f.Container != "mp4" {
+		t.Errorf("expected to find format 140, got %+v", f)
+	}
+	if f := info.Format(1); f != nil {
+		t.Errorf("expected not to find format 1, got %+v", f)
+	}
+}
@@ -1,18 +1,315 @@
 package yt
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"mime"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
+// ContentTypeJSON is the MIME-type of the Handler's responses
+const ContentTypeJSON = "application/json"
+
 // A Handler is a http.Handler which accepts GET requests for application/json
-// on its root, where the path matches a video ID, fetches the response from
-// its upstream URL, parses it, and returns it as JSON.
+// on its root, where the path matches a video ID (or the url parameter is a
+// video URL), fetches the response from its upstream URL, parses it, and
+// returns it as JSON. If the ID is followed by .mpd or .m3u8, it returns a
+// DASH manifest or an HLS master playlist of the video's adaptive formats
+// instead; the HLS media playlists are at /{id}/{itag}.m3u8. The formats
+// themselves are proxied (with the StreamingClient) at /{id}/stream/{itag},
+// since their URLs only work for the address which fetched the info, and
+// the manifests refer to them there. For the same reason, the playlists and
+// segments of live videos are proxied at /{id}/live, with their upstream
+// URLs (signed by the Handler, so that it can't be used to fetch anything
+// else) as parameters. They're signed with its SigningKey, which should be
+// set (to the same secret) for Handlers which serve the same clients, such
+// as replicas behind a load balancer, or a Handler that's restarted; if it
+// isn't, a random key is used. If it has an InfoCache, video info is looked
+// up there before it's fetched. Concurrent requests for the same video share
+// a single fetch.
 type Handler struct {
 	InfoClient      *http.Client
 	SearchClient    *http.Client
 	StreamingClient *http.Client
+	InfoCache       InfoCache
+	SigningKey      []byte
+
+	mu      sync.Mutex
+	infos   map[string]*proxiedInfo
+	flights infoGroup
+	keyOnce sync.Once
+	key     []byte
 }
 
 // ServeHTTP implements http.Handler
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		h.error(w, http.StatusMethodNotAllowed)
+		return
+	}
+	if id, itag, ok := streamRoute(r.URL.Path); ok {
+		h.stream(w, r, id, itag)
+		return
+	}
+	if id, ok := liveRoute(r.URL.Path); ok {
+		h.live(w, r, id)
+		return
+	}
+
+	id, contentType, itag, ok := route(r.URL.Path)
+	if !ok {
+		h.error(w, http.StatusNotFound)
+		return
+	}
+	if !accepts(r, contentType) {
+		h.error(w, http.StatusNotAcceptable)
+		return
+	}
+
+	if id == "" {
+		ref, err := ParseURL(r.URL.Query().Get("url"))
+		if err != nil {
+			h.error(w, http.StatusBadRequest)
+			return
+		}
+		id = ref.VideoID
+	}
+	if !InfoID.MatchString(id) {
+		h.error(w, http.StatusBadRequest)
+		return
+	}
+
+	info, err := h.get(r.Context(), id, false)
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+
+	var manifest []byte
+	switch contentType {
+	case ContentTypeDASH:
+		manifest, err = proxy(info, id+"/").DASHManifest()
+	case ContentTypeHLS:
+		manifest, err = h.hls(r.Context(), info, id, itag)
+	}
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+	if manifest != nil {
+		w.Write(manifest)
+		return
+	}
+	json.NewEncoder(w).Encode(info)
+}
+
+// route parses a request path into a video ID, the content-type of the
+// response, and the itag of a format (or 0, for the whole video).
+func route(p string) (id, contentType string, itag int, ok bool) {
+	id, ext := strings.TrimPrefix(p, "/"), ""
+	if i := strings.LastIndexByte(id, '.'); i >= 0 {
+		id, ext = id[:i], id[i:]
+	}
+	if i := strings.IndexByte(id, '/'); i >= 0 {
+		n, err := strconv.Atoi(id[i+1:])
+		if err != nil || n <= 0 {
+			return "", "", 0, false
+		}
+		id, itag = id[:i], n
+	}
+	switch ext {
+	case "":
+		return id, ContentTypeJSON, itag, itag == 0
+	case ".mpd":
+		return id, ContentTypeDASH, itag, itag == 0
+	case ".m3u8":
+		return id, ContentTypeHLS, itag, true
+	}
+	return "", "", 0, false
+}
+
+// hls gets an HLS playlist for the video: the media playlist of the format
+// with the given itag, or a master playlist. The master playlists of live
+// videos are fetched from YouTube, with their variants proxied at {id}/live;
+// others are built from the adaptive formats, with media playlists at
+// {id}/{itag}.m3u8.
+func (h *Handler) hls(ctx context.Context, info *Info, id string, itag int) ([]byte, error) {
+	if itag != 0 {
+		return proxy(info, "").HLSPlaylist(itag)
+	}
+	if u := info.StreamingData; u != nil && u.HLSManifestURL != "" {
+		return h.playlist(ctx, id, u.HLSManifestURL)
+	}
+	return info.HLSManifest(func(f *Format) string {
+		return fmt.Sprintf("%s/%d.m3u8", id, f.ITag)
+	})
+}
+
+// playlist fetches the HLS master playlist of the live video with the given
+// ID from the given URL (using the Handler's StreamingClient), rewriting its
+// URIs to those of the Handler's proxy.
+func (h *Handler) playlist(ctx context.Context, id, s string) ([]byte, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	c := h.StreamingClient
+	if c == nil {
+		c = DefaultHTTPClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{resp.StatusCode, resp.Status}
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return rewritePlaylist(u, data, func(u *url.URL) string {
+		return h.liveURI(id, id+"/", u)
+	}), nil
+}
+
+// info gets the InfoClient which the Handler uses to fetch video info
+func (h *Handler) info() *InfoClient {
+	return &InfoClient{HTTP: h.InfoClient, Cache: h.InfoCache}
+}
+
+// get gets the info of the video with the given ID, sharing the fetch with
+// any concurrent requests for it. If refresh is set, the InfoCache is
+// bypassed (and updated).
+func (h *Handler) get(ctx context.Context, id string, refresh bool) (*Info, error) {
+	key := id
+	if refresh {
+		key += "!"
+	}
+	return h.flights.do(ctx, key, func(ctx context.Context) (*Info, error) {
+		c := h.info()
+		if !refresh {
+			return c.GetContext(ctx, id)
+		}
+		c.Cache = nil
+		info, err := c.GetContext(ctx, id)
+		if err == nil && h.InfoCache != nil {
+			h.InfoCache.Put(id, info)
+		}
+		return info, err
+	})
+}
+
+// error writes a JSON error response with the given status code
+func (h *Handler) error(w http.ResponseWriter, code int) {
+	h.respond(w, code, map[string]interface{}{
+		"status": code,
+		"error":  http.StatusText(code),
+	})
+}
+
+// fail writes a JSON error response for err, with the status code which
+// best describes it. If YouTube said why a video is unavailable, its reasons
+// (and when it's scheduled to start, if it hasn't) are included, so that
+// they can be shown to users; a client is told to retry once a video is
+// scheduled to start.
+func (h *Handler) fail(w http.ResponseWriter, err error) {
+	code := statusFor(err)
+	body := map[string]interface{}{
+		"status": code,
+		"error":  http.StatusText(code),
+	}
+	var u *UnavailableError
+	if errors.As(err, &u) {
+		body["reason"] = u.Reason
+		if u.Subreason != "" {
+			body["subreason"] = u.Subreason
+		}
+		if !u.Start.IsZero() {
+			body["scheduledStart"] = u.Start
+			if d := time.Until(u.Start); d > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(d.Seconds()))))
+			}
+		}
+	}
+	h.respond(w, code, body)
+}
+
+// respond writes a JSON error response
+func (h *Handler) respond(w http.ResponseWriter, code int, body map[string]interface{}) {
+	w.Header().Set("Content-Type", ContentTypeJSON)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
+
+// statusFor gets the HTTP status code which best describes err
+func statusFor(err error) int {
+	for _, s := range []struct {
+		err  error
+		code int
+	}{
+		{ErrNoFormat, http.StatusNotFound},
+		{ErrRemoved, http.StatusGone},
+		{ErrLiveEnded, http.StatusGone},
+		{ErrPrivate, http.StatusForbidden},
+		{ErrMembersOnly, http.StatusForbidden},
+		{ErrAgeRestricted, http.StatusForbidden},
+		{ErrRegionBlocked, http.StatusUnavailableForLegalReasons},
+		{ErrNotStarted, http.StatusServiceUnavailable},
+		{ErrRateLimited, http.StatusServiceUnavailable},
+		{ErrUnavailable, http.StatusNotFound},
+		{context.DeadlineExceeded, http.StatusGatewayTimeout},
+	} {
+		if errors.Is(err, s.err) {
+			return s.code
+		}
+	}
+	return http.StatusBadGateway
+}
+
+// accepts checks whether the request's Accept header allows the given
+// content-type. A missing Accept header accepts anything.
+func accepts(r *http.Request, contentType string) bool {
+	header := r.Header.Get("Accept")
+	if header == "" {
+		return true
+	}
+	major := strings.SplitN(contentType, "/", 2)[0]
+	for _, part := range strings.Split(header, ",") {
+		t, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if q, ok := params["q"]; ok {
+			if f, err := strconv.ParseFloat(q, 64); err == nil && f <= 0 {
+				continue
+			}
+		}
+		if t == contentType || t == "*/*" || t == major+"/*" {
+			return true
+		}
+	}
+	return false
 }
@@ -1,18 +1,228 @@
 package yt
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestHandler(t *testing.T) {
-	w := httptest.NewRecorder()
-	h := new(Handler)
-	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/abcdefgh123", nil))
-	r := w.Result()
-	defer r.Body.Close()
-	if r.StatusCode != http.StatusOK {
-		t.Errorf("expected status code to be %d, got %d", http.StatusOK, r.StatusCode)
-	}
+	withInfoServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := new(playerRequest)
+		json.NewDecoder(r.Body).Decode(body)
+		w.Header().Set("Content-Type", ContentTypeJSON)
+		switch body.VideoID {
+		case "abcdefgh123":
+			fmt.Fprint(w, `{"playabilityStatus":{"status":"OK"},"videoDetails":{"videoId":"abcdefgh123"}}`)
+		case "removed1234":
+			fmt.Fprint(w, `{"playabilityStatus":{"status":"ERROR","reason":"This video has been removed by the uploader"}}`)
+		case "terminated1":
+			fmt.Fprint(w, `{"playabilityStatus":{"status":"ERROR","reason":"Video unavailable","errorScreen":{"playerErrorMessageRenderer":{"subreason":{"simpleText":"This video is no longer available because the YouTube account associated with this video has been terminated."}}}}}`)
+		case "agecheck123":
+			fmt.Fprint(w, `{"playabilityStatus":{"status":"AGE_CHECK_REQUIRED","reason":"Video unavailable"}}`)
+		case "missing1234":
+			fmt.Fprint(w, `{"playabilityStatus":{"status":"ERROR","reason":"Video unavailable"}}`)
+		case "private1234":
+			fmt.Fprint(w, `{"playabilityStatus":{"status":"LOGIN_REQUIRED","reason":"This video is private"}}`)
+		case "blocked1234":
+			fmt.Fprint(w, `{"playabilityStatus":{"status":"UNPLAYABLE","reason":"Video unavailable","errorScreen":{"playerErrorMessageRenderer":{"subreason":{"simpleText":"The uploader has not made this video available in your country"}}}}}`)
+		case "premiere123":
+			fmt.Fprint(w, `{"playabilityStatus":{"status":"LIVE_STREAM_OFFLINE","reason":"Premieres in 2 hours","liveStreamability":{"liveStreamabilityRenderer":{"offlineSlate":{"liveStreamOfflineSlateRenderer":{"scheduledStartTime":"1700000000"}}}}}}`)
+		case "upcoming123":
+			fmt.Fprintf(w, `{"playabilityStatus":{"status":"LIVE_STREAM_OFFLINE","reason":"Premieres in 1 hour","liveStreamability":{"liveStreamabilityRenderer":{"offlineSlate":{"liveStreamOfflineSlateRenderer":{"scheduledStartTime":"%d"}}}}}}`, time.Now().Add(time.Hour).Unix())
+		case "throttled12":
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "malformed12":
+			fmt.Fprint(w, `{"videoDetails":`)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}), func() {
+		for _, tc := range []struct {
+			method, path, accept string
+			status               int
+		}{
+			{http.MethodGet, "/abcdefgh123", "", http.StatusOK},
+			{http.MethodGet, "/abcdefgh123", "application/json", http.StatusOK},
+			{http.MethodGet, "/abcdefgh123", "text/html, */*;q=0.1", http.StatusOK},
+			{http.MethodGet, "/abcdefgh123", "application/*", http.StatusOK},
+			{http.MethodHead, "/abcdefgh123", "", http.StatusOK},
+			{http.MethodGet, "/abcdefgh123", "text/html", http.StatusNotAcceptable},
+			{http.MethodGet, "/abcdefgh123", "application/json;q=0, text/html", http.StatusNotAcceptable},
+			{http.MethodGet, "/abcdefgh123", "bogus/", http.StatusNotAcceptable},
+			{http.MethodPost, "/abcdefgh123", "", http.StatusMethodNotAllowed},
+			{http.MethodGet, "/abc", "", http.StatusBadRequest},
+			{http.MethodGet, "/", "", http.StatusBadRequest},
+			{http.MethodGet, "/?url=https://youtu.be/abcdefgh123", "", http.StatusOK},
+			{http.MethodGet, "/?url=https://example.com/abcdefgh123", "", http.StatusBadRequest},
+			{http.MethodGet, "/?url=https://www.youtube.com/@someone", "", http.StatusBadRequest},
+			{http.MethodGet, "/removed1234", "", http.StatusGone},
+			{http.MethodGet, "/terminated1", "", http.StatusGone},
+			{http.MethodGet, "/agecheck123", "", http.StatusForbidden},
+			{http.MethodGet, "/missing1234", "", http.StatusNotFound},
+			{http.MethodGet, "/broken12345", "", http.StatusBadGateway},
+			{http.MethodGet, "/private1234", "", http.StatusForbidden},
+			{http.MethodGet, "/blocked1234", "", http.StatusUnavailableForLegalReasons},
+			{http.MethodGet, "/premiere123", "", http.StatusServiceUnavailable},
+			{http.MethodGet, "/upcoming123", "", http.StatusServiceUnavailable},
+			{http.MethodGet, "/throttled12", "", http.StatusServiceUnavailable},
+			{http.MethodGet, "/malformed12", "", http.StatusBadGateway},
+		} {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			new(Handler).ServeHTTP(w, req)
+			r := w.Result()
+			if r.StatusCode != tc.status {
+				t.Errorf("%s %s (Accept: %q): expected status code to be %d, got %d", tc.method, tc.path, tc.accept, tc.status, r.StatusCode)
+			}
+			if ct := r.Header.Get("Content-Type"); ct != ContentTypeJSON {
+				t.Errorf("%s %s: expected Content-Type %q, got %q", tc.method, tc.path, ContentTypeJSON, ct)
+			}
+		}
+
+		w := httptest.NewRecorder()
+		new(Handler).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/abcdefgh123", nil))
+		info := new(Info)
+		if err := json.NewDecoder(w.Result().Body).Decode(info); err != nil {
+			t.Fatalf("expected a JSON body, got %v", err)
+		}
+		if info.VideoDetails.ID != "abcdefgh123" {
+			t.Errorf("expected info.VideoDetails.ID to be %q, got %q", "abcdefgh123", info.VideoDetails.ID)
+		}
+
+		for path, expected := range map[string]string{
+			"/blocked1234": `{"error":"Unavailable For Legal Reasons","reason":"Video unavailable","status":451,"subreason":"The uploader has not made this video available in your country"}`,
+			"/premiere123": `{"error":"Service Unavailable","reason":"Premieres in 2 hours","scheduledStart":"2023-11-14T22:13:20Z","status":503}`,
+			"/broken12345": `{"error":"Bad Gateway","status":502}`,
+		} {
+			w = httptest.NewRecorder()
+			new(Handler).ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+			if body := strings.TrimSpace(w.Body.String()); body != expected {
+				t.Errorf("%s: expected %s, got %s", path, expected, body)
+			}
+			if ra := w.Header().Get("Retry-After"); ra != "" {
+				t.Errorf("%s: expected no Retry-After, got %q", path, ra)
+			}
+		}
+
+		w = httptest.NewRecorder()
+		new(Handler).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/upcoming123", nil))
+		if ra, _ := strconv.Atoi(w.Header().Get("Retry-After")); ra < 3500 || ra > 3600 {
+			t.Errorf("expected to be told to retry when the premiere starts, got %q", w.Header().Get("Retry-After"))
+		}
+	})
+}
+
+func TestHandlerDASH(t *testing.T) {
+	withInfoServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := new(playerRequest)
+		json.NewDecoder(r.Body).Decode(body)
+		w.Header().Set("Content-Type", ContentTypeJSON)
+		switch body.VideoID {
+		case "abcdefgh123":
+			fmt.Fprintf(w, `{"playabilityStatus":{"status":"OK"},"videoDetails":{"videoId":"abcdefgh123"},"streamingData":{"adaptiveFormats":[%s]}}`, testFormatJSON)
+		default:
+			fmt.Fprint(w, `{"playabilityStatus":{"status":"OK"},"videoDetails":{"videoId":"nodash12345"}}`)
+		}
+	}), func() {
+		for _, tc := range []struct {
+			method, path, accept string
+			status               int
+			contentType          string
+		}{
+			{http.MethodGet, "/abcdefgh123.mpd", "", http.StatusOK, ContentTypeDASH},
+			{http.MethodGet, "/abcdefgh123.mpd", "application/dash+xml", http.StatusOK, ContentTypeDASH},
+			{http.MethodHead, "/abcdefgh123.mpd", "", http.StatusOK, ContentTypeDASH},
+			{http.MethodGet, "/abcdefgh123.mpd", "application/json", http.StatusNotAcceptable, ContentTypeJSON},
+			{http.MethodGet, "/abcdefgh123.avi", "", http.StatusNotFound, ContentTypeJSON},
+			{http.MethodGet, "/abc.mpd", "", http.StatusBadRequest, ContentTypeJSON},
+			{http.MethodGet, "/nodash12345.mpd", "", http.StatusNotFound, ContentTypeJSON},
+		} {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			new(Handler).ServeHTTP(w, req)
+			r := w.Result()
+			if r.StatusCode != tc.status {
+				t.Errorf("%s %s (Accept: %q): expected status code to be %d, got %d", tc.method, tc.path, tc.accept, tc.status, r.StatusCode)
+			}
+			if ct := r.Header.Get("Content-Type"); ct != tc.contentType {
+				t.Errorf("%s %s: expected Content-Type %q, got %q", tc.method, tc.path, tc.contentType, ct)
+			}
+		}
+
+		w := httptest.NewRecorder()
+		new(Handler).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/abcdefgh123.mpd", nil))
+		if body := w.Body.String(); !strings.Contains(body, "<BaseURL>abcdefgh123/stream/251</BaseURL>") {
+			t.Errorf("expected a DASH manifest, got %s", body)
+		}
+	})
+}
+
+func TestHandlerHLS(t *testing.T) {
+	live := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/live/index.m3u8" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1\n95/index.m3u8\n")
+	}))
+	defer live.Close()
+	withInfoServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := new(playerRequest)
+		json.NewDecoder(r.Body).Decode(body)
+		w.Header().Set("Content-Type", ContentTypeJSON)
+		switch body.VideoID {
+		case "abcdefgh123":
+			w.Write([]byte(testHLSFormats[:1] + `"playabilityStatus":{"status":"OK"},` + testHLSFormats[1:]))
+		case "livestream1":
+			fmt.Fprintf(w, `{"videoDetails":{"isLiveContent":true},"streamingData":{"hlsManifestUrl":"%s/live/index.m3u8"}}`, live.URL)
+		default:
+			fmt.Fprintf(w, `{"videoDetails":{},"streamingData":{"hlsManifestUrl":"%s/gone"}}`, live.URL)
+		}
+	}), func() {
+		for _, tc := range []struct {
+			path, accept string
+			status       int
+			body         string
+		}{
+			{"/abcdefgh123.m3u8", "", http.StatusOK, "\nabcdefgh123/137.m3u8\n"},
+			{"/abcdefgh123.m3u8", "application/vnd.apple.mpegurl", http.StatusOK, "URI=\"abcdefgh123/140.m3u8\""},
+			{"/abcdefgh123/137.m3u8", "", http.StatusOK, "#EXT-X-BYTERANGE:99259@741\nstream/137\n"},
+			{"/livestream1.m3u8", "", http.StatusOK, "\nlivestream1/live?s="},
+			{"/abcdefgh123.m3u8", "application/json", http.StatusNotAcceptable, ""},
+			{"/abcdefgh123/248.m3u8", "", http.StatusNotFound, ""},
+			{"/abcdefgh123/x.m3u8", "", http.StatusNotFound, ""},
+			{"/abcdefgh123/137", "", http.StatusNotFound, ""},
+			{"/abcdefgh123/137.mpd", "", http.StatusNotFound, ""},
+			{"/broken12345.m3u8", "", http.StatusBadGateway, ""},
+		} {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			(&Handler{StreamingClient: live.Client()}).ServeHTTP(w, req)
+			r := w.Result()
+			if r.StatusCode != tc.status {
+				t.Errorf("GET %s (Accept: %q): expected status code to be %d, got %d", tc.path, tc.accept, tc.status, r.StatusCode)
+			}
+			if tc.status == http.StatusOK && r.Header.Get("Content-Type") != ContentTypeHLS {
+				t.Errorf("GET %s: expected Content-Type %q, got %q", tc.path, ContentTypeHLS, r.Header.Get("Content-Type"))
+			}
+			if body := w.Body.String(); !strings.Contains(body, tc.body) {
+				t.Errorf("GET %s: expected the body to contain %q, got %s", tc.path, tc.body, body)
+			}
+		}
+	})
 }
@@ -0,0 +1,136 @@
+package yt
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ContentTypeHLS is the MIME-type of HLS playlists
+const ContentTypeHLS = "application/vnd.apple.mpegurl"
+
+// HLSManifest builds an HLS master playlist for the info's adaptive MP4
+// formats (which is all HLS can play), with a variant for each video format
+// and a rendition for each audio format. The URI of each format's media
+// playlist is given by uri; see HLSPlaylist.
+func (i *Info) HLSManifest(uri func(*Format) string) ([]byte, error) {
+	var videos, audios []*Format
+	for _, f := range i.hlsFormats() {
+		if f.IsVideo() {
+			videos = append(videos, f)
+		} else {
+			audios = append(audios, f)
+		}
+	}
+	if len(videos)+len(audios) == 0 {
+		return nil, fmt.Errorf("%w for HLS", ErrNoFormat)
+	}
+
+	b := new(bytes.Buffer)
+	fmt.Fprint(b, "#EXTM3U\n#EXT-X-VERSION:7\n#EXT-X-INDEPENDENT-SEGMENTS\n")
+	audio := 0
+	for n, f := range audios {
+		def := "NO"
+		if n == 0 {
+			def = "YES"
+		}
+		if f.Bitrate > audio {
+			audio = f.Bitrate
+		}
+		fmt.Fprintf(b, "#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"audio\",NAME=\"%d\",DEFAULT=%s,AUTOSELECT=YES,URI=%q\n", f.ITag, def, uri(f))
+	}
+	if len(videos) == 0 {
+		for _, f := range audios {
+			fmt.Fprintf(b, "#EXT-X-STREAM-INF:BANDWIDTH=%d,CODECS=%q\n%s\n", f.Bitrate, f.AudioCodec(), uri(f))
+		}
+		return b.Bytes(), nil
+	}
+	for _, f := range videos {
+		codecs, group := f.VideoCodec(), ""
+		if len(audios) > 0 {
+			codecs += "," + audios[0].AudioCodec()
+			group = ",AUDIO=\"audio\""
+		}
+		fmt.Fprintf(b, "#EXT-X-STREAM-INF:BANDWIDTH=%d,CODECS=%q,RESOLUTION=%dx%d,FRAME-RATE=%d%s\n%s\n", f.Bitrate+audio, codecs, f.Width, f.Height, f.FPS, group, uri(f))
+	}
+	return b.Bytes(), nil
+}
+
+// HLSPlaylist builds an HLS media playlist for the adaptive MP4 format with
+// the given itag. The stream is a single segment, with its initialization
+// given as a byte range of the stream's URL.
+func (i *Info) HLSPlaylist(itag int) ([]byte, error) {
+	var f *Format
+	for _, x := range i.hlsFormats() {
+		if x.ITag == itag {
+			f = x
+		}
+	}
+	if f == nil {
+		return nil, fmt.Errorf("%w for HLS with itag %d", ErrNoFormat, itag)
+	}
+	d := f.ApproxDuration
+	if d == 0 && i.VideoDetails != nil {
+		d = i.VideoDetails.Duration()
+	}
+	start := f.InitRange.End + 1
+
+	b := new(bytes.Buffer)
+	fmt.Fprint(b, "#EXTM3U\n#EXT-X-VERSION:7\n#EXT-X-PLAYLIST-TYPE:VOD\n")
+	fmt.Fprintf(b, "#EXT-X-TARGETDURATION:%d\n", int(math.Ceil(d.Seconds())))
+	fmt.Fprintf(b, "#EXT-X-MAP:URI=%q,BYTERANGE=\"%d@0\"\n", f.URL, start)
+	fmt.Fprintf(b, "#EXTINF:%.3f,\n", d.Seconds())
+	fmt.Fprintf(b, "#EXT-X-BYTERANGE:%d@%d\n%s\n", f.ContentLength-start, start, f.URL)
+	fmt.Fprint(b, "#EXT-X-ENDLIST\n")
+	return b.Bytes(), nil
+}
+
+// hlsFormats gets the adaptive formats which can be played with HLS
+func (i *Info) hlsFormats() []*Format {
+	if i.StreamingData == nil {
+		return nil
+	}
+	var fs []*Format
+	for _, f := range i.StreamingData.AdaptiveFormats {
+		if f.Container == "mp4" && f.URL != "" && f.InitRange != nil && f.ContentLength > f.InitRange.End+1 && f.IsVideo() != f.IsAudio() {
+			fs = append(fs, f)
+		}
+	}
+	return fs
+}
+
+// hlsURI matches the URI attributes of HLS tags
+var hlsURI = regexp.MustCompile(`URI="([^"]*)"`)
+
+// rewritePlaylist rewrites the URIs in an HLS playlist, resolved against the
+// base URL it was fetched from, with uri, so that it can be served from
+// elsewhere. URIs which can't be parsed are left as they are.
+func rewritePlaylist(base *url.URL, playlist []byte, uri func(*url.URL) string) []byte {
+	rewrite := func(s string) string {
+		u, err := base.Parse(s)
+		if err != nil {
+			return s
+		}
+		return uri(u)
+	}
+	b := new(bytes.Buffer)
+	s := bufio.NewScanner(bytes.NewReader(playlist))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#"):
+			line = hlsURI.ReplaceAllStringFunc(line, func(attr string) string {
+				return fmt.Sprintf("URI=%q", rewrite(attr[5:len(attr)-1]))
+			})
+		default:
+			line = rewrite(line)
+		}
+		fmt.Fprintln(b, line)
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,94 @@
+package yt
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const testHLSFormats = `{"videoDetails":{"lengthSeconds":"213"},"streamingData":{"adaptiveFormats":[
+	{"itag":137,"url":"https://x/137","mimeType":"video/mp4; codecs=\"avc1.640028\"","width":1920,"height":1080,"fps":30,"bitrate":4000000,"initRange":{"start":"0","end":"740"},"indexRange":{"start":"741","end":"1236"},"contentLength":"100000","approxDurationMs":"213080"},
+	{"itag":248,"url":"https://x/248","mimeType":"video/webm; codecs=\"vp9\"","width":1920,"height":1080,"fps":30,"bitrate":3000000,"initRange":{"start":"0","end":"219"},"contentLength":"100000"},
+	{"itag":140,"url":"https://x/140","mimeType":"audio/mp4; codecs=\"mp4a.40.2\"","bitrate":130000,"initRange":{"start":"0","end":"631"},"contentLength":"50000"},
+	{"itag":139,"url":"https://x/139","mimeType":"audio/mp4; codecs=\"mp4a.40.5\"","bitrate":50000,"initRange":{"start":"0","end":"631"},"contentLength":"20000"},
+	{"itag":141,"url":"https://x/141","mimeType":"audio/mp4; codecs=\"mp4a.40.2\"","bitrate":256000,"initRange":{"start":"0","end":"631"}}
+]}}`
+
+func TestHLSManifest(t *testing.T) {
+	info := new(Info)
+	if err := json.Unmarshal([]byte(testHLSFormats), info); err != nil {
+		t.Fatal(err)
+	}
+	uri := func(f *Format) string { return "v/" + f.Container + "/" + f.AudioCodec() + f.VideoCodec() }
+	b, err := info.HLSManifest(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-INDEPENDENT-SEGMENTS
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="audio",NAME="140",DEFAULT=YES,AUTOSELECT=YES,URI="v/mp4/mp4a.40.2"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="audio",NAME="139",DEFAULT=NO,AUTOSELECT=YES,URI="v/mp4/mp4a.40.5"
+#EXT-X-STREAM-INF:BANDWIDTH=4130000,CODECS="avc1.640028,mp4a.40.2",RESOLUTION=1920x1080,FRAME-RATE=30,AUDIO="audio"
+v/mp4/avc1.640028
+`
+	if string(b) != x {
+		t.Errorf("expected\n%s\ngot\n%s", x, b)
+	}
+
+	info.StreamingData.AdaptiveFormats = info.StreamingData.AdaptiveFormats[2:]
+	b, err = info.HLSManifest(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "#EXT-X-STREAM-INF:BANDWIDTH=50000,CODECS=\"mp4a.40.5\"\nv/mp4/mp4a.40.5\n") {
+		t.Errorf("expected audio-only variants, got\n%s", b)
+	}
+
+	if _, err := new(Info).HLSManifest(uri); err == nil {
+		t.Errorf("expected an error without streaming data")
+	}
+}
+
+func TestHLSPlaylist(t *testing.T) {
+	info := new(Info)
+	if err := json.Unmarshal([]byte(testHLSFormats), info); err != nil {
+		t.Fatal(err)
+	}
+	b, err := info.HLSPlaylist(137)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXT-X-TARGETDURATION:214
+#EXT-X-MAP:URI="https://x/137",BYTERANGE="741@0"
+#EXTINF:213.080,
+#EXT-X-BYTERANGE:99259@741
+https://x/137
+#EXT-X-ENDLIST
+`
+	if string(b) != x {
+		t.Errorf("expected\n%s\ngot\n%s", x, b)
+	}
+	if b, err = info.HLSPlaylist(140); err != nil || !strings.Contains(string(b), "#EXTINF:213.000,\n") {
+		t.Errorf("expected the video's duration to be used, got\n%s (%v)", b, err)
+	}
+	for _, itag := range []int{248, 141, 1} {
+		if _, err := info.HLSPlaylist(itag); err == nil {
+			t.Errorf("expected an error for itag %d", itag)
+		}
+	}
+}
+
+func TestRewritePlaylist(t *testing.T) {
+	base, _ := url.Parse("https://manifest.googlevideo.com/api/manifest/hls_variant/id/x/file/index.m3u8")
+	in := "#EXTM3U\n\n#EXT-X-MEDIA:TYPE=AUDIO,URI=\"audio/index.m3u8\"\n#EXT-X-STREAM-INF:BANDWIDTH=1\n../hls_playlist/itag/95/index.m3u8\n https://example.com/x.m3u8 \n%zz\n"
+	x := "#EXTM3U\n\n#EXT-X-MEDIA:TYPE=AUDIO,URI=\"<https://manifest.googlevideo.com/api/manifest/hls_variant/id/x/file/audio/index.m3u8>\"\n#EXT-X-STREAM-INF:BANDWIDTH=1\n<https://manifest.googlevideo.com/api/manifest/hls_variant/id/x/hls_playlist/itag/95/index.m3u8>\n<https://example.com/x.m3u8>\n%zz\n"
+	uri := func(u *url.URL) string { return "<" + u.String() + ">" }
+	if s := string(rewritePlaylist(base, []byte(in), uri)); s != x {
+		t.Errorf("expected\n%s\ngot\n%s", x, s)
+	}
+}
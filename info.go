@@ -1,17 +1,22 @@
 package yt
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"mime"
 	"net/http"
 	"net/url"
 	"regexp"
-	"strings"
+	"strconv"
+	"time"
 )
 
-// ContentTypeXWWWFormURLEncoded is the preferred MIME-type for video info
+// ContentTypeXWWWFormURLEncoded is the MIME-type of video info from the
+// retired get_video_info endpoint.
+//
+// Deprecated: video info is now fetched as JSON from the player endpoint.
 const ContentTypeXWWWFormURLEncoded = "application/x-www-form-urlencoded"
 
 // InfoID is the regular expression which video IDs must match
@@ -21,10 +26,12 @@ var InfoID *regexp.Regexp
 var InfoURL *url.URL
 
 // An InfoRepo is a repository from where YouTube video info can be obtained.
-// It provides a single function (Get) which performs the search, optionally
-// with caching.
+// It provides a function (Get) which performs the search, optionally with
+// caching, and a variant (GetContext) which gives up when the context is
+// done.
 type InfoRepo interface {
 	Get(string) (*Info, error)
+	GetContext(context.Context, string) (*Info, error)
 }
 
 // An InfoCache provides methods to store and retrieve an Info.
@@ -35,87 +42,81 @@ type InfoCache interface {
 
 // An Info represents all the data that YouTube players can use to play media.
 type Info struct {
-	VideoDetails *struct {
-		ID               string   `json:"videoId"`
-		Title            string   `json:"title"`
-		LengthSeconds    string   `json:"lengthSeconds"`
-		Keywords         []string `json:"keywords"`
-		ChannelID        string   `json:"channelId"`
-		ShortDescription string   `json:"shortDescription"`
-		Thumbnail        *struct {
-			Thumbnails []*struct {
-				URL    string `json:"url"`
-				Width  int    `json:"width"`
-				Height int    `json:"height"`
-			} `json:"thumbnails"`
-		} `json:"thumbnail"`
-
-		AverageRating float64 `json:"averageRating"`
-		AllowRatings  bool    `json:"allowRatings"`
-		ViewCount     string  `json:"viewCount"`
-		Author        string  `json:"author"`
-		IsPrivate     bool    `json:"isPrivate"`
-		IsLiveContent bool    `json:"isLiveContent"`
-	} `json:"videoDetails"`
-	StreamingData *struct {
-		ExpiresInSeconds string `json:"expiresInSeconds"`
-		Formats          []*struct {
-			ITag             int    `json:"itag"`
-			URL              string `json:"url"`
-			MIMEType         string `json:"mimeType"`
-			Bitrate          int    `json:"bitrate"`
-			Width            int    `json:"width"`
-			Height           int    `json:"height"`
-			Quality          string `json:"quality"`
-			QualityLabel     string `json:"qualityLabel"`
-			LastModified     string `json:"lastModified"`
-			ContentLength    string `json:"contentLength"`
-			FPS              int    `json:"fps"`
-			ApproxDurationMS string `json:"approxDurationMs"`
-		} `json:"formats"`
-		AdaptiveFormats []*struct {
-			ITag      int    `json:"itag"`
-			URL       string `json:"url"`
-			MIMEType  string `json:"mimeType"`
-			Bitrate   int    `json:"bitrate"`
-			Width     int    `json:"width"`
-			Height    int    `json:"height"`
-			InitRange *struct {
-				Start string `json:"start"`
-				End   string `json:"end"`
-			} `json:"initRange"`
-			IndexRange *struct {
-				Start string `json:"start"`
-				End   string `json:"end"`
-			} `json:"indexRange"`
-			LastModified     string `json:"lastModified"`
-			ContentLength    string `json:"contentLength"`
-			Quality          string `json:"quality"`
-			FPS              int    `json:"fps"`
-			QualityLabel     string `json:"qualityLabel"`
-			ProjectionType   string `json:"projectionType"`
-			AverageBitrate   int    `json:"averageBitrate"`
-			ApproxDurationMS string `json:"approxDurationMs"`
-		} `json:"adaptiveFormats"`
+	PlayabilityStatus *PlayabilityStatus `json:"playabilityStatus"`
+	VideoDetails      *VideoDetails      `json:"videoDetails"`
+	StreamingData     *struct {
+		ExpiresInSeconds string    `json:"expiresInSeconds"`
+		Formats          []*Format `json:"formats"`
+		AdaptiveFormats  []*Format `json:"adaptiveFormats"`
+		HLSManifestURL   string    `json:"hlsManifestUrl,omitempty"`
+		DASHManifestURL  string    `json:"dashManifestUrl,omitempty"`
 	} `json:"streamingData"`
 }
 
+// ttl gets how long the info's stream URLs will work for, or 0 if it's
+// unknown.
+func (i *Info) ttl() time.Duration {
+	if i.StreamingData == nil {
+		return 0
+	}
+	s, _ := strconv.Atoi(i.StreamingData.ExpiresInSeconds)
+	return time.Duration(s) * time.Second
+}
+
 // An InfoClient can fetch info for a given video ID. A zero InfoClient uses
-// defaults.
+// defaults. It tries each of its Profiles in turn, until one is given info
+// with stream URLs which its Decipherer can rewrite. If it has a Cache, it
+// looks there first, and stores what it fetches there. If Timeout is set, it
+// limits the time spent fetching info with each profile.
+//
+// Stream URLs have an n parameter which must be transformed by a function in
+// YouTube's player, or downloads are throttled. That needs a JavaScript
+// engine: its Eval (or else that of its Decipherer, or DefaultJSEvaluator).
+// Without one, n parameters are left as they are.
+//
+// To get info for videos which YouTube only plays for signed-in users (such
+// as age-restricted or members-only videos), give it the cookies of a
+// signed-in browser in a Jar (see LoadCookies), or an AuthFunc which gets
+// OAuth 2.0 access tokens (such as the Auth of a DeviceAuth or a
+// TokenSource).
 type InfoClient struct {
-	InfoID *regexp.Regexp
-	URL    *url.URL
-	HTTP   *http.Client
+	InfoID     *regexp.Regexp
+	URL        *url.URL
+	HTTP       *http.Client
+	Profiles   []*ClientProfile
+	Decipherer *Decipherer
+	Eval       JSEvaluator
+	Cache      InfoCache
+	Timeout    time.Duration
+	Jar        http.CookieJar
+	AuthFunc   func() (string, error)
 }
 
-// Get fetches the video info from it's URL (using it's http.Client).
+// Get fetches the video info from it's URL (using it's http.Client), unless
+// it's in the Cache. The id may also be any video URL understood by
+// ParseURL. If every profile fails, the error from the first is returned.
 func (i *InfoClient) Get(id string) (*Info, error) {
+	return i.GetContext(context.Background(), id)
+}
+
+// GetContext is like Get, but gives up (returning the context's error) when
+// the context is done.
+func (i *InfoClient) GetContext(ctx context.Context, id string) (*Info, error) {
 	m := i.InfoID
 	if m == nil {
 		m = InfoID
 	}
 	if !m.MatchString(id) {
-		return nil, fmt.Errorf("invalid video ID %q", id)
+		ref, err := ParseURL(id)
+		if err != nil || !m.MatchString(ref.VideoID) {
+			return nil, fmt.Errorf("invalid video ID %q", id)
+		}
+		id = ref.VideoID
+	}
+	if i.Cache != nil {
+		if info := i.Cache.Get(id); info != nil {
+			return info, nil
+		}
 	}
 
 	u := i.URL
@@ -127,52 +128,107 @@ func (i *InfoClient) Get(id string) (*Info, error) {
 		return nil, err
 	}
 	q := u.Query()
-	q.Set("video_id", id)
+	q.Set("prettyPrint", "false")
 	u.RawQuery = q.Encode()
 
+	profiles := i.Profiles
+	if len(profiles) == 0 {
+		profiles = DefaultProfiles
+	}
+
+	var first error
+	for _, p := range profiles {
+		info, err := i.get(ctx, u.String(), id, p)
+		if err == nil {
+			if i.Cache != nil {
+				i.Cache.Put(id, info)
+			}
+			return info, nil
+		}
+		if first == nil {
+			first = err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return nil, first
+}
+
+// get fetches the video info from the player endpoint at u, claiming to be
+// the given profile.
+func (i *InfoClient) get(ctx context.Context, u, id string, p *ClientProfile) (*Info, error) {
+	if i.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, i.Timeout)
+		defer cancel()
+	}
+	req, err := p.request(u, id)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
 	c := i.HTTP
 	if c == nil {
 		c = new(http.Client)
 	}
+	if i.Jar != nil {
+		jc := *c
+		jc.Jar, c = i.Jar, &jc
+		if auth := sapisidHash(i.Jar, req.URL, req.Header.Get("Origin")); auth != "" {
+			req.Header.Set("Authorization", auth)
+			req.Header.Set("X-Origin", req.Header.Get("Origin"))
+		}
+	}
+	if i.AuthFunc != nil {
+		auth, err := i.AuthFunc()
+		if err != nil {
+			return nil, err
+		}
+		authorize(req, auth)
+	}
 
-	resp, err := c.Get(u.String())
+	resp, err := c.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("response status %d (%s)", resp.StatusCode, resp.Status)
+		return nil, &StatusError{resp.StatusCode, resp.Status}
 	}
 
-	contentType := resp.Header.Get("Content-Type")
-	if contentType != ContentTypeXWWWFormURLEncoded {
-		return nil, fmt.Errorf("unexpected response content type %q", contentType)
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if contentType != ContentTypeJSON {
+		return nil, &MalformedResponseError{fmt.Errorf("unexpected response content type %q", resp.Header.Get("Content-Type"))}
 	}
 
-	data, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	info := new(Info)
+	if err := json.NewDecoder(resp.Body).Decode(info); err != nil {
+		return nil, &MalformedResponseError{err}
 	}
 
-	values, err := url.ParseQuery(string(data))
-	if err != nil {
+	if err := info.PlayabilityStatus.Err(); err != nil {
 		return nil, err
 	}
-
-	if values.Get("status") == "fail" {
-		return nil, fmt.Errorf("errorcode %s (%s)", values.Get("errorcode"), values.Get("reason"))
+	if info.VideoDetails == nil {
+		return nil, &MalformedResponseError{errors.New("no videoDetails")}
 	}
 
-	pr := values.Get("player_response")
-	if pr == "" {
-		return nil, errors.New("no player_response")
+	d := i.Decipherer
+	if d == nil {
+		d = DefaultDecipherer
+	}
+	eval := i.Eval
+	if eval == nil {
+		eval = d.Eval
+	}
+	if err := d.decipher(ctx, info, eval); err != nil {
+		return nil, err
 	}
 
-	info := new(Info)
-	err = json.NewDecoder(strings.NewReader(pr)).Decode(info)
-
-	return info, err
+	return info, nil
 }
 
 // GetInfo gets video info for the video with the given ID
@@ -181,7 +237,13 @@ func GetInfo(id string) (*Info, error) {
 	return c.Get(id)
 }
 
+// GetInfoContext is like GetInfo, but gives up when the context is done.
+func GetInfoContext(ctx context.Context, id string) (*Info, error) {
+	c := new(InfoClient)
+	return c.GetContext(ctx, id)
+}
+
 func init() {
 	InfoID = regexp.MustCompile("^[[:word:]]([[:word:]]|-){10}$")
-	InfoURL, _ = url.Parse("https://youtube.com/get_video_info")
+	InfoURL, _ = url.Parse("https://www.youtube.com/youtubei/v1/player")
 }
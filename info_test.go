@@ -1,30 +1,234 @@
 package yt
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestGetInfo(t *testing.T) {
 	withInfoServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", ContentTypeXWWWFormURLEncoded)
-		fmt.Fprint(w, `player_response={"videoDetails":{"videoId": "abcdefghij"}}`)
+		if r.Method != http.MethodPost {
+			t.Errorf("expected a POST, got %s", r.Method)
+		}
+		body := new(playerRequest)
+		if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+			t.Errorf("expected a JSON player request, got %v", err)
+		}
+		if name := body.Context.Client.ClientName; name != "WEB" {
+			t.Errorf("expected the WEB profile to be tried first, got %q", name)
+		}
+		if r.Header.Get("X-YouTube-Client-Name") != "1" {
+			t.Errorf("expected X-YouTube-Client-Name to be %q, got %q", "1", r.Header.Get("X-YouTube-Client-Name"))
+		}
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		fmt.Fprintf(w, `{"playabilityStatus":{"status":"OK"},"videoDetails":{"videoId":%q}}`, body.VideoID)
 	}), func() {
 		i, err := GetInfo("abcdefghijk")
 		if err != nil {
-			t.Fatalf("expected no error, got %e", err)
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if i.VideoDetails.ID != "abcdefghijk" {
+			t.Errorf("expected info.VideoDetails.ID to be %q, got %q", "abcdefghijk", i.VideoDetails.ID)
+		}
+		if _, err := GetInfo("https://youtu.be/abcdefghijk?t=5"); err != nil {
+			t.Errorf("expected no error getting info by URL, got %v", err)
+		}
+		for _, id := range []string{"abc", "https://www.youtube.com/@someone"} {
+			if _, err := GetInfo(id); err == nil {
+				t.Errorf("expected an error getting info for %q", id)
+			}
+		}
+	})
+}
+
+func TestInfoClientProfiles(t *testing.T) {
+	var tried []string
+	withInfoServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := new(playerRequest)
+		json.NewDecoder(r.Body).Decode(body)
+		client := body.Context.Client
+		tried = append(tried, client.ClientName)
+		w.Header().Set("Content-Type", ContentTypeJSON)
+		switch client.ClientName {
+		case "WEB":
+			fmt.Fprint(w, `{"playabilityStatus":{"status":"LOGIN_REQUIRED","reason":"Sign in to confirm your age"}}`)
+		case "ANDROID":
+			if client.AndroidSDKVersion != 30 {
+				t.Errorf("expected androidSdkVersion to be 30, got %d", client.AndroidSDKVersion)
+			}
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			if body.Context.ThirdParty == nil || body.Context.ThirdParty.EmbedURL == "" {
+				t.Errorf("expected an embedUrl for %s", client.ClientName)
+			}
+			fmt.Fprint(w, `{"videoDetails":{"videoId":"abcdefghijk"}}`)
+		}
+	}), func() {
+		i, err := new(InfoClient).Get("abcdefghijk")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if i.VideoDetails.ID != "abcdefghijk" {
+			t.Errorf("expected info.VideoDetails.ID to be %q, got %q", "abcdefghijk", i.VideoDetails.ID)
+		}
+		if fmt.Sprint(tried) != "[WEB ANDROID TVHTML5_SIMPLY_EMBEDDED_PLAYER]" {
+			t.Errorf("expected each profile to be tried in turn, got %v", tried)
+		}
+
+		_, err = (&InfoClient{Profiles: []*ClientProfile{WebProfile, AndroidProfile}}).Get("abcdefghijk")
+		if u, ok := err.(*UnavailableError); !ok || u.Code != "LOGIN_REQUIRED" {
+			t.Errorf("expected the first profile's error, got %v", err)
+		}
+	})
+}
+
+func TestInfoClientCache(t *testing.T) {
+	var fetches int
+	withInfoServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Header().Set("Content-Type", ContentTypeJSON)
+		fmt.Fprint(w, `{"videoDetails":{"videoId":"abcdefghijk"},"streamingData":{"expiresInSeconds":"21540"}}`)
+	}), func() {
+		c := &InfoClient{Cache: new(LRUInfoCache)}
+		a, err := c.Get("abcdefghijk")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		b, err := c.Get("https://youtu.be/abcdefghijk")
+		if err != nil || b.VideoDetails != a.VideoDetails {
+			t.Errorf("expected the cached info, got %v (%v)", b, err)
+		}
+		if fetches != 1 {
+			t.Errorf("expected the info to be fetched once, got %d", fetches)
+		}
+		if _, err := c.Get("abc"); err == nil {
+			t.Errorf("expected an error for an invalid ID")
+		}
+	})
+}
+
+func TestInfoClientContext(t *testing.T) {
+	release := make(chan struct{})
+	withInfoServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Content-Type", ContentTypeJSON)
+		fmt.Fprint(w, `{"videoDetails":{"videoId":"abcdefghijk"}}`)
+	}), func() {
+		defer close(release)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := GetInfoContext(ctx, "abcdefghijk"); err != context.Canceled {
+			t.Errorf("expected the context's error, got %v", err)
+		}
+
+		start := time.Now()
+		_, err := (&InfoClient{Timeout: 10 * time.Millisecond}).GetContext(context.Background(), "abcdefghijk")
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the deadline to be exceeded, got %v", err)
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("expected each profile to time out, took %v", d)
 		}
-		if i.VideoDetails.ID != "abcdefghij" {
-			t.Errorf("expected info.VideoDetails.ID to be %q, got %q", "abcdefghij", i.VideoDetails.ID)
+		if status := statusFor(err); status != http.StatusGatewayTimeout {
+			t.Errorf("expected a timeout to be a 504, got %d", status)
 		}
 	})
 }
 
+func TestInfoClientAuth(t *testing.T) {
+	var auths, cookies []string
+	withInfoServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auths = append(auths, r.Header.Get("Authorization"))
+		if c, err := r.Cookie("SAPISID"); err == nil {
+			cookies = append(cookies, c.Value)
+		}
+		w.Header().Set("Content-Type", ContentTypeJSON)
+		fmt.Fprint(w, `{"videoDetails":{"videoId":"abcdefghijk"}}`)
+	}), func() {
+		jar, _ := cookiejar.New(nil)
+		jar.SetCookies(InfoURL, []*http.Cookie{{Name: "SAPISID", Value: "secret"}})
+		if _, err := (&InfoClient{Jar: jar}).Get("abcdefghijk"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(auths) != 1 || !strings.HasPrefix(auths[0], "SAPISIDHASH ") || fmt.Sprint(cookies) != "[secret]" {
+			t.Errorf("expected the cookies and a SAPISIDHASH, got %v and %v", cookies, auths)
+		}
+
+		auths = nil
+		c := &InfoClient{AuthFunc: func() (string, error) { return "access", nil }}
+		if _, err := c.Get("abcdefghijk"); err != nil || fmt.Sprint(auths) != "[Bearer access]" {
+			t.Errorf("expected a bearer token, got %v (%v)", auths, err)
+		}
+		c.AuthFunc = func() (string, error) { return "", errors.New("not authorized") }
+		if _, err := c.Get("abcdefghijk"); err == nil || err.Error() != "not authorized" {
+			t.Errorf("expected the AuthFunc's error, got %v", err)
+		}
+		auths = nil
+		c.AuthFunc = func() (string, error) { return "", nil }
+		if _, err := c.Get("abcdefghijk"); err != nil || len(auths) != 1 || auths[0] != "" {
+			t.Errorf("expected no Authorization, got %q", auths)
+		}
+	})
+}
+
+func TestInfoClientErrors(t *testing.T) {
+	withInfoServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := new(playerRequest)
+		json.NewDecoder(r.Body).Decode(body)
+		switch body.VideoID {
+		case "text-------":
+			w.Header().Set("Content-Type", "text/html")
+		case "junk-------":
+			w.Header().Set("Content-Type", ContentTypeJSON)
+			fmt.Fprint(w, `{`)
+		case "empty------":
+			w.Header().Set("Content-Type", ContentTypeJSON)
+			fmt.Fprint(w, `{}`)
+		}
+	}), func() {
+		c := &InfoClient{Profiles: []*ClientProfile{WebProfile}}
+		for _, id := range []string{"text-------", "junk-------", "empty------"} {
+			if _, err := c.Get(id); err == nil {
+				t.Errorf("expected an error getting info for %q", id)
+			}
+		}
+		c.URL = &url.URL{Scheme: "http", Host: "%zz"}
+		if _, err := c.Get("abcdefghijk"); err == nil {
+			t.Errorf("expected a URL error")
+		}
+		c.URL = &url.URL{Scheme: "bogus", Host: "localhost"}
+		if _, err := c.Get("abcdefghijk"); err == nil {
+			t.Errorf("expected a transport error")
+		}
+	})
+}
+
+func TestUnavailableError(t *testing.T) {
+	err := &UnavailableError{Code: "ERROR", Reason: "This video has been removed by the uploader"}
+	if err.Error() != "errorcode ERROR (This video has been removed by the uploader)" {
+		t.Errorf("unexpected error message %q", err.Error())
+	}
+	if !err.Removed() {
+		t.Errorf("expected %v to be removed", err)
+	}
+}
+
 func withInfoServer(h http.Handler, f func()) {
 	ts := httptest.NewServer(h)
+	defer ts.Close()
 	u, _ := url.Parse(ts.URL)
 	defer func(u *url.URL) { InfoURL = u }(InfoURL)
 	InfoURL = u
@@ -0,0 +1,362 @@
+package yt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// An mp4Box is a box (or atom) of an MP4 file: its type, and all of its
+// bytes, including its header (which is hdr bytes long).
+type mp4Box struct {
+	typ  string
+	data []byte
+	hdr  int
+}
+
+// payload gets the contents of the box, after its header
+func (b *mp4Box) payload() []byte {
+	return b.data[b.hdr:]
+}
+
+// parseBoxes splits data into boxes. The boxes share data, so changing them
+// changes it.
+func parseBoxes(data []byte) ([]*mp4Box, error) {
+	var boxes []*mp4Box
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return nil, errors.New("truncated MP4 box")
+		}
+		size, hdr := uint64(binary.BigEndian.Uint32(data)), 8
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return nil, errors.New("truncated MP4 box")
+			}
+			size, hdr = binary.BigEndian.Uint64(data[8:]), 16
+		}
+		if size < uint64(hdr) || size > uint64(len(data)) {
+			return nil, fmt.Errorf("invalid size of MP4 box %q", data[4:8])
+		}
+		boxes = append(boxes, &mp4Box{string(data[4:8]), data[:size], hdr})
+		data = data[size:]
+	}
+	return boxes, nil
+}
+
+// findBox finds the first box of the given type, following a path of types
+// through the boxes' children.
+func findBox(boxes []*mp4Box, path ...string) *mp4Box {
+	for _, b := range boxes {
+		if b.typ != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			return b
+		}
+		children, err := parseBoxes(b.payload())
+		if err != nil {
+			return nil
+		}
+		return findBox(children, path[1:]...)
+	}
+	return nil
+}
+
+// makeBox builds a box of the given type, with the given contents
+func makeBox(typ string, contents ...[]byte) []byte {
+	size := 8
+	for _, c := range contents {
+		size += len(c)
+	}
+	b := make([]byte, 8, size)
+	binary.BigEndian.PutUint32(b, uint32(size))
+	copy(b[4:], typ)
+	for _, c := range contents {
+		b = append(b, c...)
+	}
+	return b
+}
+
+// readBoxHeader reads the header of the next box from r, returning its type,
+// its total size (or 0, if it extends to the end of the file), and the
+// header's bytes. It returns io.EOF if there are no more boxes.
+func readBoxHeader(r io.Reader) (string, int64, []byte, error) {
+	hdr := make([]byte, 8, 16)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return "", 0, nil, err
+	}
+	size := int64(binary.BigEndian.Uint32(hdr))
+	if size == 1 {
+		hdr = hdr[:16]
+		if _, err := io.ReadFull(r, hdr[8:]); err != nil {
+			return "", 0, nil, unexpected(err)
+		}
+		size = int64(binary.BigEndian.Uint64(hdr[8:]))
+	}
+	if size != 0 && size < int64(len(hdr)) {
+		return "", 0, nil, fmt.Errorf("invalid size of MP4 box %q", hdr[4:8])
+	}
+	return string(hdr[4:8]), size, hdr, nil
+}
+
+// muxMP4 writes a fragmented MP4 file with the video and audio tracks. Its
+// movie header has the video's track (renumbered 1) and the audio's
+// (renumbered 2), and its fragments are interleaved.
+func muxMP4(w *countingWriter, v, a *muxTrack) error {
+	vinit, err := parseBoxes(v.init)
+	if err != nil {
+		return err
+	}
+	ainit, err := parseBoxes(a.init)
+	if err != nil {
+		return err
+	}
+	ftyp := findBox(vinit, "ftyp")
+	vmvhd, amvhd := findBox(vinit, "moov", "mvhd"), findBox(ainit, "moov", "mvhd")
+	vtrak, atrak := findBox(vinit, "moov", "trak"), findBox(ainit, "moov", "trak")
+	vmvex := findBox(vinit, "moov", "mvex")
+	vtrex, atrex := findBox(vinit, "moov", "mvex", "trex"), findBox(ainit, "moov", "mvex", "trex")
+	if ftyp == nil || vmvhd == nil || amvhd == nil || vtrak == nil || atrak == nil || vtrex == nil || atrex == nil {
+		return errors.New("MP4 streams aren't fragmented")
+	}
+	vscale, err := mp4Timescale(vtrak)
+	if err != nil {
+		return err
+	}
+	ascale, err := mp4Timescale(atrak)
+	if err != nil {
+		return err
+	}
+
+	// the audio's edit list is in the units of its own movie header
+	sameScale := mvhdTimescale(vmvhd) == mvhdTimescale(amvhd)
+	vt, err := retrack(vtrak, 1, true)
+	if err != nil {
+		return err
+	}
+	at, err := retrack(atrak, 2, sameScale)
+	if err != nil {
+		return err
+	}
+	mvhd, vtrexp, atrexp := vmvhd.payload(), vtrex.payload(), atrex.payload()
+	if len(mvhd) < 4 || len(vtrexp) < 8 || len(atrexp) < 8 {
+		return errors.New("truncated MP4 movie header")
+	}
+	binary.BigEndian.PutUint32(mvhd[len(mvhd)-4:], 3)
+	binary.BigEndian.PutUint32(vtrexp[4:], 1)
+	binary.BigEndian.PutUint32(atrexp[4:], 2)
+
+	var mvex [][]byte
+	vchildren, _ := parseBoxes(vmvex.payload())
+	for _, b := range vchildren {
+		if b.typ != "trex" {
+			mvex = append(mvex, b.data)
+		}
+	}
+	mvex = append(mvex, vtrex.data, atrex.data)
+
+	moov := [][]byte{vmvhd.data, vt, at, makeBox("mvex", mvex...)}
+	vmoov, _ := parseBoxes(findBox(vinit, "moov").payload())
+	for _, b := range vmoov {
+		switch b.typ {
+		case "mvhd", "trak", "mvex":
+		default:
+			moov = append(moov, b.data)
+		}
+	}
+	if _, err := w.Write(ftyp.data); err != nil {
+		return err
+	}
+	if _, err := w.Write(makeBox("moov", moov...)); err != nil {
+		return err
+	}
+
+	var seq uint32
+	return interleave(w,
+		&mp4Fragments{r: v.r, id: 1, scale: vscale, seq: &seq},
+		&mp4Fragments{r: a.r, id: 2, scale: ascale, seq: &seq},
+	)
+}
+
+// retrack rebuilds a track, with the given ID; its edit list is dropped
+// unless edits is set.
+func retrack(trak *mp4Box, id uint32, edits bool) ([]byte, error) {
+	children, err := parseBoxes(trak.payload())
+	if err != nil {
+		return nil, err
+	}
+	var contents [][]byte
+	for _, b := range children {
+		switch b.typ {
+		case "tkhd":
+			p := b.payload()
+			off := 12
+			if len(p) > 0 && p[0] == 1 {
+				off = 20
+			}
+			if len(p) < off+4 {
+				return nil, errors.New("truncated MP4 track header")
+			}
+			binary.BigEndian.PutUint32(p[off:], id)
+		case "edts":
+			if !edits {
+				continue
+			}
+		}
+		contents = append(contents, b.data)
+	}
+	return makeBox("trak", contents...), nil
+}
+
+// mp4Timescale gets the number of units per second of a track's media
+func mp4Timescale(trak *mp4Box) (uint64, error) {
+	mdhd := findBox([]*mp4Box{trak}, "trak", "mdia", "mdhd")
+	if mdhd == nil {
+		return 0, errors.New("MP4 track has no media header")
+	}
+	p := mdhd.payload()
+	off := 12
+	if len(p) > 0 && p[0] == 1 {
+		off = 20
+	}
+	if len(p) < off+4 || binary.BigEndian.Uint32(p[off:]) == 0 {
+		return 0, errors.New("invalid MP4 media header")
+	}
+	return uint64(binary.BigEndian.Uint32(p[off:])), nil
+}
+
+// mvhdTimescale gets the number of units per second of a movie header
+func mvhdTimescale(mvhd *mp4Box) uint32 {
+	p := mvhd.payload()
+	off := 12
+	if len(p) > 0 && p[0] == 1 {
+		off = 20
+	}
+	if len(p) < off+4 {
+		return 0
+	}
+	return binary.BigEndian.Uint32(p[off:])
+}
+
+// mp4Fragments are the movie fragments (moof boxes, and the mdat boxes
+// which follow them) of an MP4 track. As they're written, they're given the
+// track ID id, and sequence numbers from seq (which is shared by all of the
+// tracks).
+type mp4Fragments struct {
+	r     *countingReader
+	id    uint32
+	scale uint64
+	seq   *uint32
+
+	moof []byte
+	pos  int64
+	t    float64
+}
+
+// peek implements fragments
+func (f *mp4Fragments) peek() (float64, error) {
+	for f.moof == nil {
+		pos := f.r.n
+		typ, size, hdr, err := readBoxHeader(f.r)
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case typ == "mdat":
+			return 0, errors.New("MP4 media data without a movie fragment")
+		case size == 0:
+			return 0, fmt.Errorf("unsized MP4 box %q", typ)
+		case typ == "moof" && size > maxFragmentSize:
+			return 0, fmt.Errorf("MP4 movie fragment of %d bytes", size)
+		case typ == "moof":
+			moof := make([]byte, size)
+			copy(moof, hdr)
+			if _, err := io.ReadFull(f.r, moof[len(hdr):]); err != nil {
+				return 0, unexpected(err)
+			}
+			f.moof, f.pos = moof, pos
+		default:
+			if _, err := io.CopyN(ioutil.Discard, f.r, size-int64(len(hdr))); err != nil {
+				return 0, unexpected(err)
+			}
+		}
+	}
+
+	boxes, err := parseBoxes(f.moof)
+	if err != nil {
+		return 0, err
+	}
+	if tfdt := findBox(boxes, "moof", "traf", "tfdt"); tfdt != nil {
+		p := tfdt.payload()
+		switch {
+		case len(p) >= 12 && p[0] == 1:
+			f.t = float64(binary.BigEndian.Uint64(p[4:])) / float64(f.scale)
+		case len(p) >= 8:
+			f.t = float64(binary.BigEndian.Uint32(p[4:])) / float64(f.scale)
+		}
+	}
+	return f.t, nil
+}
+
+// write implements fragments
+func (f *mp4Fragments) write(w *countingWriter) error {
+	boxes, _ := parseBoxes(f.moof)
+	children, err := parseBoxes(boxes[0].payload())
+	if err != nil {
+		return err
+	}
+	for _, b := range children {
+		p := b.payload()
+		switch b.typ {
+		case "mfhd":
+			if len(p) < 8 {
+				return errors.New("truncated MP4 fragment header")
+			}
+			*f.seq++
+			binary.BigEndian.PutUint32(p[4:], *f.seq)
+		case "traf":
+			tfhd := findBox([]*mp4Box{b}, "traf", "tfhd")
+			if tfhd == nil || len(tfhd.payload()) < 8 {
+				return errors.New("MP4 track fragment has no header")
+			}
+			p := tfhd.payload()
+			binary.BigEndian.PutUint32(p[4:], f.id)
+			if p[3]&1 != 0 && len(p) >= 16 {
+				// the base data offset is from the start of the file
+				base := int64(binary.BigEndian.Uint64(p[8:]))
+				binary.BigEndian.PutUint64(p[8:], uint64(base-f.pos+w.n))
+			}
+		}
+	}
+	if _, err := w.Write(f.moof); err != nil {
+		return err
+	}
+	f.moof = nil
+
+	typ, size, hdr, err := readBoxHeader(f.r)
+	if err != nil {
+		return unexpected(err)
+	}
+	if typ != "mdat" || size == 0 {
+		return errors.New("MP4 movie fragment without media data")
+	}
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+	_, err = io.CopyN(w, f.r, size-int64(len(hdr)))
+	return unexpected(err)
+}
+
+// unexpected turns io.EOF, which is only expected at the end of a stream,
+// into io.ErrUnexpectedEOF
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,176 @@
+package yt
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// maxFragmentSize is the size of the largest header, MP4 movie fragment or
+// WebM cluster which Mux reads into memory; anything larger is taken to be
+// corrupt.
+const maxFragmentSize = 256 << 20
+
+// Mux combines an adaptive video format and an adaptive audio format, read
+// from the beginning of their streams, into a single file which it writes to
+// w. The formats must both be MP4 (in which case the result is a fragmented
+// MP4) or both be WebM. Their init ranges say where their headers end, and
+// their index ranges are skipped, since the muxed file's fragments are laid
+// out differently.
+func Mux(w io.Writer, video *Format, vr io.Reader, audio *Format, ar io.Reader) error {
+	if !video.IsVideo() || video.IsAudio() {
+		return fmt.Errorf("format %d isn't video-only", video.ITag)
+	}
+	if !audio.IsAudio() || audio.IsVideo() {
+		return fmt.Errorf("format %d isn't audio-only", audio.ITag)
+	}
+	if video.Container != audio.Container {
+		return fmt.Errorf("can't mux %s video with %s audio", video.Container, audio.Container)
+	}
+	if video.Container != "mp4" && video.Container != "webm" {
+		return fmt.Errorf("can't mux %s", video.Container)
+	}
+	v, err := newMuxTrack(video, vr)
+	if err != nil {
+		return err
+	}
+	a, err := newMuxTrack(audio, ar)
+	if err != nil {
+		return err
+	}
+	if video.Container == "mp4" {
+		return muxMP4(&countingWriter{w: w}, v, a)
+	}
+	return muxWebM(&countingWriter{w: w}, v, a)
+}
+
+// DownloadMuxed downloads the video and audio formats with the given itags
+// from info at the same time, and muxes them (see Mux) into w. Progress is
+// reported for both together.
+func (d *Downloader) DownloadMuxed(ctx context.Context, info *Info, video, audio int, w io.Writer) error {
+	vf, af := info.Format(video), info.Format(audio)
+	if vf == nil {
+		return fmt.Errorf("%w with itag %d", ErrNoFormat, video)
+	}
+	if af == nil {
+		return fmt.Errorf("%w with itag %d", ErrNoFormat, audio)
+	}
+	total := vf.ContentLength + af.ContentLength
+	if vf.ContentLength <= 0 || af.ContentLength <= 0 {
+		total = -1
+	}
+	m := &meter{total: total, f: d.Progress}
+	each := *d
+	each.Progress = nil
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	vr, vw := io.Pipe()
+	ar, aw := io.Pipe()
+	var wg sync.WaitGroup
+	fetch := func(itag int, pw *io.PipeWriter) {
+		defer wg.Done()
+		_, err := each.Download(ctx, info, itag, &progress{pw, m})
+		pw.CloseWithError(err)
+	}
+	wg.Add(2)
+	go fetch(video, vw)
+	go fetch(audio, aw)
+
+	err := Mux(w, vf, vr, af, ar)
+	cancel()
+	vr.Close()
+	ar.Close()
+	wg.Wait()
+	return err
+}
+
+// A muxTrack is a stream being muxed: its header (from its init range), and
+// a reader of the fragments which follow its index.
+type muxTrack struct {
+	init []byte
+	r    *countingReader
+}
+
+// newMuxTrack reads the header of the format's stream from r, and skips its
+// index.
+func newMuxTrack(f *Format, r io.Reader) (*muxTrack, error) {
+	if f.InitRange == nil || f.IndexRange == nil || f.InitRange.Start != 0 || f.InitRange.End < 0 || f.IndexRange.Start <= f.InitRange.End || f.IndexRange.End < f.IndexRange.Start || f.ContentLength > 0 && f.IndexRange.End >= f.ContentLength {
+		return nil, fmt.Errorf("format %d has no usable init and index ranges", f.ITag)
+	}
+	if f.InitRange.End >= maxFragmentSize {
+		return nil, fmt.Errorf("format %d has a %d byte header", f.ITag, f.InitRange.End+1)
+	}
+	init := make([]byte, f.InitRange.End+1)
+	if _, err := io.ReadFull(r, init); err != nil {
+		return nil, fmt.Errorf("format %d: %w", f.ITag, unexpected(err))
+	}
+	skip := f.IndexRange.End + 1 - int64(len(init))
+	if _, err := io.CopyN(ioutil.Discard, r, skip); err != nil {
+		return nil, fmt.Errorf("format %d: %w", f.ITag, unexpected(err))
+	}
+	return &muxTrack{init, &countingReader{r, f.IndexRange.End + 1}}, nil
+}
+
+// fragments are the self-contained pieces of a track which is being muxed:
+// MP4 movie fragments, or WebM clusters.
+type fragments interface {
+	// peek reads the next fragment (unless it already has), and gets the
+	// time (in seconds) at which it starts. It returns io.EOF when there
+	// are no more.
+	peek() (float64, error)
+	// write writes the fragment which was peeked.
+	write(w *countingWriter) error
+}
+
+// interleave writes the fragments of two tracks to w, in order of time
+func interleave(w *countingWriter, a, b fragments) error {
+	for {
+		ta, errA := a.peek()
+		if errA != nil && errA != io.EOF {
+			return errA
+		}
+		tb, errB := b.peek()
+		if errB != nil && errB != io.EOF {
+			return errB
+		}
+		if errA == io.EOF && errB == io.EOF {
+			return nil
+		}
+		next := a
+		if errA == io.EOF || errB == nil && tb < ta {
+			next = b
+		}
+		if err := next.write(w); err != nil {
+			return err
+		}
+	}
+}
+
+// A countingWriter counts the bytes written to its io.Writer
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write implements io.Writer
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// A countingReader counts the bytes read from its io.Reader
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+// Read implements io.Reader
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,492 @@
+package yt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func u32(vs ...uint32) []byte {
+	b := make([]byte, 4*len(vs))
+	for i, v := range vs {
+		binary.BigEndian.PutUint32(b[4*i:], v)
+	}
+	return b
+}
+
+func u64(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+// testMP4 builds a fragmented MP4 stream of a single track, with a fragment
+// for each of the times (in units of the scale), holding the payload
+// "{name}{i}". If absolute is set, the fragments' base data offsets are from
+// the start of the file.
+func testMP4(mimeType string, id, scale uint32, times []uint64, name string, absolute bool) ([]byte, *Format) {
+	ftyp := makeBox("ftyp", []byte("iso6"), u32(0), []byte("iso6dash"))
+	mvhd := makeBox("mvhd", u32(0), u32(0, 0, 1000, 0), make([]byte, 76), u32(id+1))
+	tkhd := makeBox("tkhd", u32(0), u32(0, 0, id, 0, 0), make([]byte, 60))
+	mdhd := makeBox("mdhd", u32(0), u32(0, 0, scale, 0), u32(0))
+	trak := makeBox("trak", tkhd, makeBox("edts", makeBox("elst", u32(0, 0))), makeBox("mdia", mdhd))
+	mvex := makeBox("mvex", makeBox("mehd", u32(0, 0)), makeBox("trex", u32(0), u32(id, 1, 0, 0, 0)))
+	init := append(ftyp, makeBox("moov", mvhd, trak, mvex, makeBox("udta"))...)
+	sidx := makeBox("sidx", u32(0, id, scale))
+
+	data := append(append([]byte{}, init...), sidx...)
+	for i, t := range times {
+		mdat := makeBox("mdat", []byte(fmt.Sprintf("%s%d", name, i)))
+		moof := func(offset uint32) []byte {
+			tfhd := makeBox("tfhd", u32(0x020000, id))
+			if absolute {
+				tfhd = makeBox("tfhd", u32(1, id), u64(uint64(len(data))))
+			}
+			traf := makeBox("traf", tfhd, makeBox("tfdt", u32(1<<24), u64(t)), makeBox("trun", u32(1, 1, offset)))
+			return makeBox("moof", makeBox("mfhd", u32(0, uint32(i+100))), traf)
+		}
+		m := moof(0)
+		data = append(data, moof(uint32(len(m)+8))...)
+		data = append(data, mdat...)
+		data = append(data, makeBox("free", []byte("x"))...)
+	}
+	return data, &Format{
+		MIMEType:      mimeType,
+		Container:     "mp4",
+		Codecs:        []string{strings.Split(strings.Split(mimeType, `"`)[1], `"`)[0]},
+		InitRange:     &Range{0, int64(len(init) - 1)},
+		IndexRange:    &Range{int64(len(init)), int64(len(init) + len(sidx) - 1)},
+		ContentLength: int64(len(data)),
+	}
+}
+
+func TestMuxMP4(t *testing.T) {
+	video, vf := testMP4(`video/mp4; codecs="avc1.640028"`, 1, 90000, []uint64{0, 180000}, "V", false)
+	audio, af := testMP4(`audio/mp4; codecs="mp4a.40.2"`, 7, 48000, []uint64{0, 48000, 144000}, "A", true)
+	vf.ITag, af.ITag = 137, 140
+
+	b := new(bytes.Buffer)
+	if err := Mux(b, vf, bytes.NewReader(video), af, bytes.NewReader(audio)); err != nil {
+		t.Fatal(err)
+	}
+	out := b.Bytes()
+	boxes, err := parseBoxes(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, b := range boxes {
+		types = append(types, b.typ)
+	}
+	if s := strings.Join(types, " "); s != "ftyp moov moof mdat moof mdat moof mdat moof mdat moof mdat" {
+		t.Fatalf("unexpected boxes %s", s)
+	}
+
+	moov, _ := parseBoxes(boxes[1].payload())
+	var children []string
+	for _, b := range moov {
+		children = append(children, b.typ)
+	}
+	if s := strings.Join(children, " "); s != "mvhd trak trak mvex udta" {
+		t.Errorf("unexpected movie boxes %s", s)
+	}
+	if p := moov[0].payload(); binary.BigEndian.Uint32(p[len(p)-4:]) != 3 {
+		t.Errorf("expected the next track ID to be 3")
+	}
+	for i, trak := range moov[1:3] {
+		tkhd := findBox([]*mp4Box{trak}, "trak", "tkhd")
+		if id := binary.BigEndian.Uint32(tkhd.payload()[12:]); id != uint32(i+1) {
+			t.Errorf("expected track %d to have ID %d, got %d", i, i+1, id)
+		}
+	}
+	mvex, _ := parseBoxes(moov[3].payload())
+	if len(mvex) != 3 || mvex[0].typ != "mehd" || binary.BigEndian.Uint32(mvex[1].payload()[4:]) != 1 || binary.BigEndian.Uint32(mvex[2].payload()[4:]) != 2 {
+		t.Errorf("expected a mehd and a trex for each track")
+	}
+
+	pos := len(boxes[0].data) + len(boxes[1].data)
+	for i, x := range []struct {
+		id      uint32
+		payload string
+	}{{1, "V0"}, {2, "A0"}, {2, "A1"}, {1, "V1"}, {2, "A2"}} {
+		moof, mdat := boxes[2+2*i], boxes[3+2*i]
+		if string(mdat.payload()) != x.payload {
+			t.Errorf("expected fragment %d to be %s, got %s", i, x.payload, mdat.payload())
+		}
+		mfhd := findBox([]*mp4Box{moof}, "moof", "mfhd")
+		if seq := binary.BigEndian.Uint32(mfhd.payload()[4:]); seq != uint32(i+1) {
+			t.Errorf("expected fragment %d to have sequence number %d, got %d", i, i+1, seq)
+		}
+		tfhd := findBox([]*mp4Box{moof}, "moof", "traf", "tfhd").payload()
+		if id := binary.BigEndian.Uint32(tfhd[4:]); id != x.id {
+			t.Errorf("expected fragment %d to be of track %d, got %d", i, x.id, id)
+		}
+		base := uint64(pos)
+		if tfhd[3]&1 != 0 {
+			base = binary.BigEndian.Uint64(tfhd[8:])
+		}
+		trun := findBox([]*mp4Box{moof}, "moof", "traf", "trun").payload()
+		start := base + uint64(binary.BigEndian.Uint32(trun[8:]))
+		if s := string(out[start : start+2]); s != x.payload {
+			t.Errorf("expected fragment %d's data to point to %s, got %s", i, x.payload, s)
+		}
+		pos += len(moof.data) + len(mdat.data)
+	}
+}
+
+// testWebM builds a WebM stream of a single track, with a cluster for each
+// of the times, holding a block with the payload "{name}{i}".
+func testWebM(mimeType string, number uint64, scale uint64, times []uint64, name string) ([]byte, *Format) {
+	el := func(id uint32, data ...[]byte) []byte {
+		return encodeElement(id, bytes.Join(data, nil))
+	}
+	init := el(ebmlHeaderID, el(0x4282, []byte("webm")))
+	init = append(init, 0x18, 0x53, 0x80, 0x67, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF)
+	init = append(init, el(0x114D9B74, el(0x4DBB))...)
+	init = append(init, el(0xEC, make([]byte, 10))...)
+	init = append(init, el(infoID, el(timecodeScaleID, encodeUint(scale)), el(0x4D80, []byte("test")))...)
+	init = append(init, el(tracksID, el(trackEntryID, el(trackNumberID, encodeUint(number)), el(trackUIDID, encodeUint(12345)), el(0x86, []byte(mimeType))))...)
+	cues := el(0x1C53BB6B, el(0xBB))
+
+	data := append(append([]byte{}, init...), cues...)
+	for i, t := range times {
+		block := append([]byte{0x80 | byte(number), 0, 0, 0x80}, fmt.Sprintf("%s%d", name, i)...)
+		if i%2 == 0 {
+			data = append(data, el(clusterID, el(timecodeID, encodeUint(t)), el(simpleBlockID, block))...)
+		} else {
+			data = append(data, el(clusterID, el(timecodeID, encodeUint(t)), el(blockGroupID, el(blockID, block), el(0xFB, encodeUint(1))))...)
+		}
+	}
+	data = append(data, el(0x1254C367, el(0x7373))...)
+	return data, &Format{
+		MIMEType:      mimeType,
+		Container:     "webm",
+		InitRange:     &Range{0, int64(len(init) - 1)},
+		IndexRange:    &Range{int64(len(init)), int64(len(init) + len(cues) - 1)},
+		ContentLength: int64(len(data)),
+	}
+}
+
+func TestMuxWebM(t *testing.T) {
+	video, vf := testWebM(`video/webm; codecs="vp9"`, 1, 1000000, []uint64{0, 5000}, "V")
+	audio, af := testWebM(`audio/webm; codecs="opus"`, 1, 1000000, []uint64{0, 2000, 6000}, "A")
+	vf.Codecs, af.Codecs = []string{"vp9"}, []string{"opus"}
+
+	b := new(bytes.Buffer)
+	if err := Mux(b, vf, bytes.NewReader(video), af, bytes.NewReader(audio)); err != nil {
+		t.Fatal(err)
+	}
+	r := bytes.NewReader(b.Bytes())
+	if id, _, _, err := readElementHeader(r); err != nil || id != ebmlHeaderID {
+		t.Fatalf("expected an EBML header, got %X (%v)", id, err)
+	}
+	_, size, _, _ := readElementHeader(r)
+	r.Seek(size, io.SeekCurrent)
+	if id, size, _, err := readElementHeader(r); err != nil || id != segmentID || size != -1 {
+		t.Fatalf("expected a segment of unknown size, got %X of %d (%v)", id, size, err)
+	}
+	rest := make([]byte, r.Len())
+	r.Read(rest)
+	elements, err := parseElements(rest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(elements) != 7 || elements[0].id != infoID || elements[1].id != tracksID {
+		t.Fatalf("expected info, tracks and 5 clusters, got %d elements", len(elements))
+	}
+	entries, _ := parseElements(elements[1].data)
+	for i, e := range entries {
+		fields, _ := parseElements(e.data)
+		n, uid := findElement(fields, trackNumberID), findElement(fields, trackUIDID)
+		if decodeUint(n.data) != uint64(i+1) || decodeUint(uid.data) != uint64(i+1) {
+			t.Errorf("expected track %d to be renumbered", i)
+		}
+	}
+	for i, x := range []struct {
+		number  byte
+		payload string
+	}{{1, "V0"}, {2, "A0"}, {2, "A1"}, {1, "V1"}, {2, "A2"}} {
+		c := elements[2+i]
+		if c.id != clusterID {
+			t.Fatalf("expected element %d to be a cluster, got %X", i, c.id)
+		}
+		if !bytes.HasSuffix(c.data, []byte{0x80 | x.number, 0, 0, 0x80, x.payload[0], x.payload[1]}) && !bytes.Contains(c.data, []byte{0x80 | x.number, 0, 0, 0x80, x.payload[0], x.payload[1], 0xFB}) {
+			t.Errorf("expected cluster %d to have block %s of track %d, got % X", i, x.payload, x.number, c.data)
+		}
+	}
+}
+
+func TestMuxErrors(t *testing.T) {
+	video, vf := testMP4(`video/mp4; codecs="avc1.640028"`, 1, 90000, []uint64{0}, "V", false)
+	audio, af := testMP4(`audio/mp4; codecs="mp4a.40.2"`, 1, 48000, []uint64{0}, "A", false)
+	wvideo, wvf := testWebM(`video/webm; codecs="vp9"`, 1, 1000000, []uint64{0}, "V")
+	waudio, waf := testWebM(`audio/webm; codecs="opus"`, 1, 1000000, []uint64{0}, "A")
+	wvf.Codecs, waf.Codecs = []string{"vp9"}, []string{"opus"}
+	muxed := new(Format)
+	json := `{"mimeType":"video/mp4; codecs=\"avc1.42001E, mp4a.40.2\""}`
+	muxed.UnmarshalJSON([]byte(json))
+	threegp := &Format{MIMEType: "video/3gpp", Container: "3gpp", Codecs: []string{"mp4v"}}
+	threegpa := &Format{MIMEType: "audio/3gpp", Container: "3gpp", Codecs: []string{"mp4a"}}
+	noRanges := *af
+	noRanges.IndexRange = nil
+	badRanges := *af
+	badRanges.InitRange = &Range{0, af.IndexRange.End}
+	longIndex := *af
+	longIndex.IndexRange = &Range{af.IndexRange.Start, int64(len(audio))}
+	longIndex.ContentLength = 0
+	pastEnd := longIndex
+	pastEnd.ContentLength = int64(len(audio))
+	negativeInit := *af
+	negativeInit.InitRange = &Range{0, -10}
+	negativeInit.IndexRange = &Range{0, 10}
+	hugeInit := *af
+	hugeInit.InitRange = &Range{0, maxFragmentSize}
+	hugeInit.IndexRange = &Range{maxFragmentSize + 1, maxFragmentSize + 10}
+	hugeInit.ContentLength = 0
+
+	corrupt := func(data []byte, f func([]byte) []byte) []byte {
+		return f(append([]byte{}, data...))
+	}
+	init := int(af.InitRange.End + 1)
+	frag := int(af.IndexRange.End + 1)
+
+	for _, tc := range []struct {
+		name   string
+		vf     *Format
+		video  []byte
+		af     *Format
+		audio  []byte
+		expect string
+	}{
+		{"muxed video", muxed, video, af, audio, "isn't video-only"},
+		{"video as audio", vf, video, vf, video, "isn't audio-only"},
+		{"mixed containers", vf, video, waf, waudio, "can't mux mp4 video with webm audio"},
+		{"3gpp", threegp, nil, threegpa, nil, "can't mux 3gpp"},
+		{"no ranges", vf, video, &noRanges, audio, "no usable init and index ranges"},
+		{"no ranges", &noRanges, video, af, audio, "isn't video-only"},
+		{"bad ranges", vf, video, &badRanges, audio, "no usable init and index ranges"},
+		{"short init", vf, video, af, audio[:init-5], "unexpected EOF"},
+		{"short index", vf, video, &longIndex, audio, "unexpected EOF"},
+		{"index past the end", vf, video, &pastEnd, audio, "no usable init and index ranges"},
+		{"negative init", vf, video, &negativeInit, audio, "no usable init and index ranges"},
+		{"huge init", vf, video, &hugeInit, audio, "byte header"},
+		{"bad init", vf, video, af, corrupt(audio, func(b []byte) []byte { b[3] = 2; return b }), "invalid size"},
+		{"bad video init", vf, corrupt(video, func(b []byte) []byte { b[3] = 2; return b }), af, audio, "invalid size"},
+		{"unfragmented", vf, video, af, corrupt(audio, func(b []byte) []byte { copy(b[bytes.Index(b, []byte("mvex")):], "xxxx"); return b }), "aren't fragmented"},
+		{"mdat first", vf, video, af, corrupt(audio, func(b []byte) []byte { copy(b[frag+4:], "mdat"); return b }), "without a movie fragment"},
+		{"unsized", vf, video, af, corrupt(audio, func(b []byte) []byte { copy(b[frag:], u32(0)); return b }), "unsized MP4 box"},
+		{"huge", vf, video, af, corrupt(audio, func(b []byte) []byte { copy(b[frag:], u32(maxFragmentSize+1)); return b }), "movie fragment of"},
+		{"truncated", vf, video, af, audio[:frag+20], "unexpected EOF"},
+		{"truncated mdat", vf, video, af, audio[:len(audio)-12], "unexpected EOF"},
+		{"bad webm", wvf, wvideo, waf, corrupt(waudio, func(b []byte) []byte { b[0] = 0; return b }), "no EBML header"},
+		{"bad webm video", wvf, corrupt(wvideo, func(b []byte) []byte { b[0] = 0; return b }), waf, waudio, "no EBML header"},
+		{"bad webm scale", wvf, wvideo, waf, bytes.Replace(waudio, []byte{0x2A, 0xD7, 0xB1, 0x83, 0x0F, 0x42, 0x40}, []byte{0x2A, 0xD7, 0xB1, 0x83, 0x0F, 0x42, 0x41}, 1), "different timecode scales"},
+		{"truncated webm", wvf, wvideo, waf, waudio[:len(waudio)-4], "unexpected EOF"},
+	} {
+		err := Mux(new(bytes.Buffer), tc.vf, bytes.NewReader(tc.video), tc.af, bytes.NewReader(tc.audio))
+		if err == nil || !strings.Contains(err.Error(), tc.expect) {
+			t.Errorf("%s: expected an error (%s), got %v", tc.name, tc.expect, err)
+		}
+	}
+}
+
+func TestDownloadMuxed(t *testing.T) {
+	video, vf := testMP4(`video/mp4; codecs="avc1.640028"`, 1, 90000, []uint64{0, 180000}, "V", false)
+	audio, af := testMP4(`audio/mp4; codecs="mp4a.40.2"`, 1, 48000, []uint64{0, 48000, 144000}, "A", false)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/137":
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(video))
+		case "/140":
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(audio))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+	vf.ITag, vf.URL = 137, ts.URL+"/137"
+	af.ITag, af.URL = 140, ts.URL+"/140"
+	broken := *af
+	broken.ITag, broken.URL = 141, ts.URL+"/141"
+	info := new(Info)
+	if err := info.UnmarshalJSON([]byte(`{"streamingData":{}}`)); err != nil {
+		t.Fatal(err)
+	}
+	info.StreamingData.AdaptiveFormats = []*Format{vf, af, &broken}
+
+	x := new(bytes.Buffer)
+	if err := Mux(x, vf, bytes.NewReader(video), af, bytes.NewReader(audio)); err != nil {
+		t.Fatal(err)
+	}
+	var written, total int64
+	d := &Downloader{HTTP: ts.Client(), ChunkSize: 64, Progress: func(w, t int64) {
+		written, total = w, t
+	}}
+	b := new(bytes.Buffer)
+	if err := d.DownloadMuxed(context.Background(), info, 137, 140, b); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b.Bytes(), x.Bytes()) {
+		t.Errorf("expected the downloaded streams to be muxed")
+	}
+	if n := int64(len(video) + len(audio)); written != n || total != n {
+		t.Errorf("expected progress of %d/%d, got %d/%d", n, n, written, total)
+	}
+
+	for _, itags := range [][2]int{{137, 141}, {1, 140}, {137, 1}} {
+		if err := d.DownloadMuxed(context.Background(), info, itags[0], itags[1], new(bytes.Buffer)); err == nil {
+			t.Errorf("expected an error muxing %v", itags)
+		} else if itags[0] == 1 || itags[1] == 1 {
+			if !errors.Is(err, ErrNoFormat) {
+				t.Errorf("expected ErrNoFormat muxing %v, got %v", itags, err)
+			}
+		}
+	}
+	vf.ContentLength = 0
+	if err := d.DownloadMuxed(context.Background(), info, 137, 140, new(bytes.Buffer)); err != nil || total != -1 {
+		t.Errorf("expected an unknown total, got %d (%v)", total, err)
+	}
+}
+
+func TestMP4Boxes(t *testing.T) {
+	large := append(u32(1), []byte("free")...)
+	large = append(large, u64(20)...)
+	large = append(large, "abcd"...)
+	boxes, err := parseBoxes(append(large, append(u32(0), []byte("mdat1234")...)...))
+	if err != nil || len(boxes) != 2 || string(boxes[0].payload()) != "abcd" || string(boxes[1].payload()) != "1234" {
+		t.Errorf("expected a large box and an unsized box, got %v (%v)", boxes, err)
+	}
+	for _, data := range [][]byte{[]byte("abc"), append(u32(1), "free1234"...), append(u32(4), "free"...), append(u32(99), "free"...)} {
+		if _, err := parseBoxes(data); err == nil {
+			t.Errorf("expected an error parsing % X", data)
+		}
+	}
+	if findBox([]*mp4Box{{"moov", append(u32(99), "trak"...), 0}}, "moov", "trak") != nil {
+		t.Errorf("expected not to find a box in a broken parent")
+	}
+
+	typ, size, hdr, err := readBoxHeader(bytes.NewReader(large))
+	if err != nil || typ != "free" || size != 20 || len(hdr) != 16 {
+		t.Errorf("expected a large box header, got %s %d %d (%v)", typ, size, len(hdr), err)
+	}
+	for _, data := range [][]byte{append(u32(1), "free1234"...), append(u32(4), "free"...)} {
+		if _, _, _, err := readBoxHeader(bytes.NewReader(data)); err == nil {
+			t.Errorf("expected an error reading % X", data)
+		}
+	}
+
+	v1 := func(typ string, off int, v uint32) *mp4Box {
+		p := make([]byte, off+4)
+		p[0] = 1
+		binary.BigEndian.PutUint32(p[off:], v)
+		return &mp4Box{typ, makeBox(typ, p), 8}
+	}
+	if s := mvhdTimescale(v1("mvhd", 20, 600)); s != 600 {
+		t.Errorf("expected a version 1 movie header's timescale, got %d", s)
+	}
+	if s := mvhdTimescale(&mp4Box{"mvhd", makeBox("mvhd"), 8}); s != 0 {
+		t.Errorf("expected no timescale in a truncated movie header, got %d", s)
+	}
+	trak := func(boxes ...[]byte) *mp4Box {
+		return &mp4Box{"trak", makeBox("trak", boxes...), 8}
+	}
+	if s, err := mp4Timescale(trak(makeBox("mdia", v1("mdhd", 20, 44100).data))); err != nil || s != 44100 {
+		t.Errorf("expected a version 1 media header's timescale, got %d (%v)", s, err)
+	}
+	for _, b := range []*mp4Box{trak(), trak(makeBox("mdia", makeBox("mdhd", u32(0))))} {
+		if _, err := mp4Timescale(b); err == nil {
+			t.Errorf("expected an error getting the timescale of % X", b.data)
+		}
+	}
+	tk := v1("tkhd", 20, 9)
+	b, err := retrack(trak(tk.data, makeBox("edts")), 2, false)
+	if err != nil || len(b) != 8+len(tk.data) || binary.BigEndian.Uint32(b[36:]) != 2 {
+		t.Errorf("expected a renumbered version 1 track without edits, got % X (%v)", b, err)
+	}
+	for _, b := range []*mp4Box{trak(makeBox("tkhd", u32(0))), trak(append(u32(99), "tkhd"...))} {
+		if _, err := retrack(b, 2, true); err == nil {
+			t.Errorf("expected an error retracking % X", b.data)
+		}
+	}
+}
+
+func TestEBML(t *testing.T) {
+	for _, n := range []int{0, 126, 127, 16382, 16383} {
+		e := encodeElement(0xEC, make([]byte, n))
+		elements, err := parseElements(e)
+		if err != nil || len(elements) != 1 || len(elements[0].data) != n {
+			t.Errorf("expected an element of %d bytes to round-trip (%v)", n, err)
+		}
+	}
+	for _, data := range [][]byte{{0}, {0xEC}, {0xFF, 0x80, 0x80, 0x80, 0x80, 0x81}, {0xEC, 0xFF}, {0xEC, 0x85}} {
+		if _, err := parseElements(data); err == nil {
+			t.Errorf("expected an error parsing % X", data)
+		}
+	}
+	if id, size, _, err := readElementHeader(bytes.NewReader([]byte{0x1F, 0x43, 0xB6, 0x75, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF})); err != nil || id != clusterID || size != -1 {
+		t.Errorf("expected an unsized cluster, got %X %d (%v)", id, size, err)
+	}
+	if _, err := readVint(bytes.NewReader([]byte{0x40})); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected a truncated integer, got %v", err)
+	}
+	if findElement(nil, clusterID) != nil {
+		t.Errorf("expected not to find an element")
+	}
+
+	el := func(id uint32, data ...[]byte) []byte {
+		return encodeElement(id, bytes.Join(data, nil))
+	}
+	ebml := el(ebmlHeaderID)
+	segment := []byte{0x18, 0x53, 0x80, 0x67, 0x80}
+	header := func(children ...[]byte) []byte {
+		return bytes.Join(append([][]byte{ebml, segment}, children...), nil)
+	}
+	for _, init := range [][]byte{
+		ebml,
+		append(append([]byte{}, ebml...), 0xEC, 0x80),
+		header([]byte{0xEC, 0x85}),
+		header(el(infoID)),
+		header(el(infoID, []byte{0xEC}), el(tracksID)),
+		header(el(infoID), el(tracksID, []byte{0xEC})),
+		header(el(infoID), el(tracksID)),
+		header(el(infoID), el(tracksID, el(trackEntryID, []byte{0xEC}))),
+	} {
+		if _, err := parseWebMHeader(init); err == nil {
+			t.Errorf("expected an error parsing the header % X", init)
+		}
+	}
+	h, err := parseWebMHeader(header(el(infoID), el(tracksID, el(trackEntryID))))
+	if err != nil || h.timecodeScale != 1000000 || h.trackNumber() != 0 {
+		t.Errorf("expected a header with defaults, got %+v (%v)", h, err)
+	}
+
+	f := &webmFragments{r: bytes.NewReader(el(clusterID, []byte{0xEC})), scale: 1}
+	if _, err := f.peek(); err == nil {
+		t.Errorf("expected an error peeking at a broken cluster")
+	}
+	for _, cluster := range [][]byte{el(simpleBlockID), el(simpleBlockID, []byte{0x40}), el(blockGroupID, []byte{0xEC})} {
+		f := &webmFragments{r: bytes.NewReader(el(clusterID, cluster)), scale: 1}
+		if _, err := f.peek(); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.write(&countingWriter{w: new(bytes.Buffer)}); err == nil {
+			t.Errorf("expected an error writing the cluster % X", cluster)
+		}
+	}
+	f = &webmFragments{r: bytes.NewReader([]byte{0x1F, 0x43, 0xB6, 0x75, 0xFF}), scale: 1}
+	if _, err := f.peek(); err == nil {
+		t.Errorf("expected an error peeking at an unsized cluster")
+	}
+	f = &webmFragments{r: bytes.NewReader([]byte{0x1F, 0x43, 0xB6, 0x75, 0x01, 0x00, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}), scale: 1}
+	if _, err := f.peek(); err == nil || !strings.Contains(err.Error(), "WebM cluster of") {
+		t.Errorf("expected an error peeking at a huge cluster, got %v", err)
+	}
+}
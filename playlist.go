@@ -0,0 +1,182 @@
+package yt
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// PlaylistID is the regular expression which playlist IDs must match
+var PlaylistID *regexp.Regexp
+
+// PlaylistURL is the URL of the endpoint from which we list playlist entries
+var PlaylistURL *url.URL
+
+// A Playlist contains information about a YouTube playlist
+type Playlist struct {
+	ID          string       `json:"id"`
+	Title       string       `json:"title"`
+	ChannelID   string       `json:"channelId"`
+	ChannelName string       `json:"channelName"`
+	Published   time.Time    `json:"published"`
+	Thumbnails  []*Thumbnail `json:"thumbnails"`
+	ItemCount   int64        `json:"itemCount"`
+}
+
+// Type implements Result
+func (p *Playlist) Type() string {
+	return "playlist"
+}
+
+// A PlaylistClient can list the videos in a playlist. A zero PlaylistClient
+// uses defaults. If Timeout is set, it limits the time spent fetching each
+// page of entries. If Failed is set, it's called when a page after the first
+// fails.
+type PlaylistClient struct {
+	AuthFunc func() (string, error)
+	URL      *url.URL
+	PerPage  int
+	Timeout  time.Duration
+	Client   *http.Client
+	Failed   func(*PageError)
+}
+
+// Get lists the videos in the playlist with the given ID (or URL), in
+// playlist order. Like SearchClient.Get, the first page is fetched before Get
+// returns, and the rest as the channel is drained; the channel is closed
+// after the last entry, when a page fails (after calling Failed), or when the
+// context is done.
+func (c *PlaylistClient) Get(ctx context.Context, id string) (chan *Video, error) {
+	if !PlaylistID.MatchString(id) {
+		ref, err := ParseURL(id)
+		if err != nil || ref.PlaylistID == "" {
+			return nil, fmt.Errorf("invalid playlist ID %q", id)
+		}
+		id = ref.PlaylistID
+	}
+	page, videos, err := c.page(ctx, id, "")
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan *Video)
+	go func(ch chan *Video) {
+		defer close(ch)
+		for n := 2; ; n++ {
+			for _, v := range videos {
+				select {
+				case ch <- v:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if page.NextPageToken == "" {
+				return
+			}
+			if page, videos, err = c.page(ctx, id, page.NextPageToken); err != nil {
+				if ctx.Err() == nil && c.Failed != nil {
+					c.Failed(&PageError{n, err})
+				}
+				return
+			}
+		}
+	}(ch)
+	return ch, nil
+}
+
+// page fetches a single page of playlist entries, and their details
+func (c *PlaylistClient) page(ctx context.Context, id, token string) (*playlistPage, []*Video, error) {
+	n := c.PerPage
+	if n <= 0 {
+		n = DefaultPerPage
+	}
+	q := url.Values{}
+	q.Set("part", "snippet,contentDetails")
+	q.Set("playlistId", id)
+	q.Set("maxResults", strconv.Itoa(n))
+	if token != "" {
+		q.Set("pageToken", token)
+	}
+	a := c.api()
+	page := new(playlistPage)
+	if err := a.fetch(ctx, "", q, page); err != nil {
+		return nil, nil, err
+	}
+
+	var results []*Video
+	var ids []string
+	videos := map[string]*Video{}
+	for _, item := range page.Items {
+		v := item.video()
+		if _, ok := videos[v.ID]; !ok {
+			ids = append(ids, v.ID)
+		}
+		videos[v.ID] = v
+		results = append(results, v)
+	}
+	if err := a.videos(ctx, ids, videos); err != nil {
+		return nil, nil, err
+	}
+	return page, results, nil
+}
+
+// api gets the api used by the PlaylistClient, with defaults filled in
+func (c *PlaylistClient) api() *api {
+	a := &api{c.AuthFunc, c.URL, c.Timeout, c.Client}
+	if a.auth == nil {
+		a.auth = AuthFunc
+	}
+	if a.url == nil {
+		a.url = PlaylistURL
+	}
+	if a.client == nil {
+		a.client = DefaultHTTPClient
+	}
+	return a
+}
+
+// A playlistPage is a single page of entries from the playlist endpoint
+type playlistPage struct {
+	NextPageToken string          `json:"nextPageToken"`
+	Items         []*playlistItem `json:"items"`
+}
+
+// A playlistItem is a single entry in a playlist
+type playlistItem struct {
+	Snippet        *snippet `json:"snippet"`
+	ContentDetails struct {
+		VideoID          string    `json:"videoId"`
+		VideoPublishedAt time.Time `json:"videoPublishedAt"`
+	} `json:"contentDetails"`
+}
+
+// video converts the entry to a Video
+func (i *playlistItem) video() *Video {
+	v := &Video{
+		ID:        i.ContentDetails.VideoID,
+		Published: i.ContentDetails.VideoPublishedAt,
+	}
+	if s := i.Snippet; s != nil {
+		if v.ID == "" {
+			v.ID = s.ResourceID.VideoID
+		}
+		v.Title = s.Title
+		v.ChannelID = s.VideoOwnerChannelID
+		v.ChannelName = s.VideoOwnerChannelTitle
+		v.Thumbnails = s.thumbnails()
+	}
+	return v
+}
+
+// GetPlaylist lists the videos in the playlist with the given ID.
+func GetPlaylist(ctx context.Context, id string) (chan *Video, error) {
+	return new(PlaylistClient).Get(ctx, id)
+}
+
+func init() {
+	PlaylistID = regexp.MustCompile("^(PL|UU|UL|LL|FL|RD|OL|PU|EL)([[:word:]]|-){10,}$")
+	PlaylistURL, _ = url.Parse("https://www.googleapis.com/youtube/v3/playlistItems")
+}
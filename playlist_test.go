@@ -0,0 +1,144 @@
+package yt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestGetPlaylist(t *testing.T) {
+	withPlaylistServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path == "/videos" {
+			if q.Get("id") != "aaaaaaaaaaa,bbbbbbbbbbb" && q.Get("id") != "ccccccccccc" {
+				t.Errorf("unexpected video IDs %q", q.Get("id"))
+			}
+			fmt.Fprint(w, `{"items":[{"id":"aaaaaaaaaaa","contentDetails":{"duration":"PT1M"}}]}`)
+			return
+		}
+		if q.Get("playlistId") != "PLxxxxxxxxxxxxxxxx" {
+			t.Errorf("unexpected playlistId %q", q.Get("playlistId"))
+		}
+		switch q.Get("pageToken") {
+		case "":
+			fmt.Fprint(w, `{"nextPageToken":"p2","items":[
+				{"snippet":{"title":"A","videoOwnerChannelId":"UCx","videoOwnerChannelTitle":"X"},
+				 "contentDetails":{"videoId":"aaaaaaaaaaa","videoPublishedAt":"2020-05-01T12:00:00Z"}},
+				{"snippet":{"title":"B","resourceId":{"videoId":"bbbbbbbbbbb"}}}
+			]}`)
+		case "p2":
+			fmt.Fprint(w, `{"items":[{"contentDetails":{"videoId":"ccccccccccc"}}]}`)
+		}
+	}), func() {
+		vs, err := GetPlaylist(context.Background(), "https://www.youtube.com/playlist?list=PLxxxxxxxxxxxxxxxx")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		var videos []*Video
+		for v := range vs {
+			videos = append(videos, v)
+		}
+		if len(videos) != 3 {
+			t.Fatalf("expected 3 videos, got %d", len(videos))
+		}
+		v := videos[0]
+		if v.ID != "aaaaaaaaaaa" || v.Title != "A" || v.ChannelID != "UCx" || v.ChannelName != "X" || v.Duration != time.Minute {
+			t.Errorf("unexpected video %#v", v)
+		}
+		if !v.Published.Equal(time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)) {
+			t.Errorf("unexpected publish time %s", v.Published)
+		}
+		if videos[1].ID != "bbbbbbbbbbb" || videos[2].ID != "ccccccccccc" {
+			t.Errorf("unexpected videos %v, %v", videos[1], videos[2])
+		}
+	})
+}
+
+func TestPlaylistClient(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path == "/videos" {
+			if q.Get("id") == "bad" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			fmt.Fprint(w, `{}`)
+			return
+		}
+		switch q.Get("playlistId") {
+		case "PLfailfailfail":
+			w.WriteHeader(http.StatusNotFound)
+		case "PLbadvideos1":
+			fmt.Fprint(w, `{"items":[{"contentDetails":{"videoId":"bad"}}]}`)
+		case "PLmoremoremore":
+			if q.Get("pageToken") != "" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			fmt.Fprint(w, `{"nextPageToken":"x","items":[{"contentDetails":{"videoId":"a"}}]}`)
+		default:
+			fmt.Fprint(w, `{"nextPageToken":"x","items":[{"contentDetails":{"videoId":"a"}},{"contentDetails":{"videoId":"a"}}]}`)
+		}
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	c := &PlaylistClient{URL: u, PerPage: 2, Timeout: time.Second, Client: ts.Client()}
+
+	for _, id := range []string{"", "xyz", "https://youtu.be/aqz-KE-bpKQ", "PLfailfailfail", "PLbadvideos1"} {
+		if _, err := c.Get(context.Background(), id); err == nil {
+			t.Errorf("expected an error listing %q", id)
+		}
+	}
+
+	var e *PageError
+	c.Failed = func(err *PageError) { e = err }
+	vs, err := c.Get(context.Background(), "PLmoremoremore")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	n := 0
+	for range vs {
+		n++
+	}
+	if n != 1 {
+		t.Errorf("expected entries to stop at a failed page, got %d", n)
+	}
+	var se *StatusError
+	if e == nil || e.Page != 2 || !errors.As(e, &se) || se.StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected page 2 to fail with 500, got %v", e)
+	}
+
+	e = nil
+	ctx, cancel := context.WithCancel(context.Background())
+	vs, err = c.Get(ctx, "PLforeverforever")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	<-vs
+	cancel()
+	for range vs {
+	}
+	if e != nil {
+		t.Errorf("expected no page error after cancelling, got %v", e)
+	}
+}
+
+func TestPlaylistType(t *testing.T) {
+	if x := new(Playlist).Type(); x != "playlist" {
+		t.Errorf("expected playlist type to be %q, got %q", "playlist", x)
+	}
+}
+
+func withPlaylistServer(h http.Handler, f func()) {
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	defer func(u *url.URL) { PlaylistURL = u }(PlaylistURL)
+	PlaylistURL = u
+	f()
+}
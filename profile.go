@@ -0,0 +1,104 @@
+package yt
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// A ClientProfile describes the player which an InfoClient claims to be when
+// it requests video info. Different profiles are served different formats,
+// and are blocked for different videos.
+type ClientProfile struct {
+	Name              string
+	Version           string
+	ID                int
+	UserAgent         string
+	AndroidSDKVersion int
+	EmbedURL          string
+}
+
+// WebProfile is the profile of the desktop web player
+var WebProfile = &ClientProfile{
+	Name:      "WEB",
+	Version:   "2.20230728.00.00",
+	ID:        1,
+	UserAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/115.0",
+}
+
+// AndroidProfile is the profile of the Android app
+var AndroidProfile = &ClientProfile{
+	Name:              "ANDROID",
+	Version:           "18.11.34",
+	ID:                3,
+	UserAgent:         "com.google.android.youtube/18.11.34 (Linux; U; Android 11) gzip",
+	AndroidSDKVersion: 30,
+}
+
+// TVEmbeddedProfile is the profile of the embedded player on smart TVs, which
+// can often play videos the others can't.
+var TVEmbeddedProfile = &ClientProfile{
+	Name:     "TVHTML5_SIMPLY_EMBEDDED_PLAYER",
+	Version:  "2.0",
+	ID:       85,
+	EmbedURL: "https://www.youtube.com/",
+}
+
+// DefaultProfiles are the profiles an InfoClient tries, in order, when it
+// doesn't specify any.
+var DefaultProfiles = []*ClientProfile{WebProfile, AndroidProfile, TVEmbeddedProfile}
+
+// A playerRequest is the body of a request to the player endpoint
+type playerRequest struct {
+	Context struct {
+		Client struct {
+			ClientName        string `json:"clientName"`
+			ClientVersion     string `json:"clientVersion"`
+			AndroidSDKVersion int    `json:"androidSdkVersion,omitempty"`
+			HL                string `json:"hl"`
+		} `json:"client"`
+		ThirdParty *struct {
+			EmbedURL string `json:"embedUrl"`
+		} `json:"thirdParty,omitempty"`
+	} `json:"context"`
+	VideoID        string `json:"videoId"`
+	ContentCheckOK bool   `json:"contentCheckOk"`
+	RacyCheckOK    bool   `json:"racyCheckOk"`
+}
+
+// request builds a request for info about the given video from the player
+// endpoint at the given URL.
+func (p *ClientProfile) request(u, id string) (*http.Request, error) {
+	body := new(playerRequest)
+	body.Context.Client.ClientName = p.Name
+	body.Context.Client.ClientVersion = p.Version
+	body.Context.Client.AndroidSDKVersion = p.AndroidSDKVersion
+	body.Context.Client.HL = "en"
+	if p.EmbedURL != "" {
+		body.Context.ThirdParty = &struct {
+			EmbedURL string `json:"embedUrl"`
+		}{p.EmbedURL}
+	}
+	body.VideoID = id
+	body.ContentCheckOK = true
+	body.RacyCheckOK = true
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", ContentTypeJSON)
+	req.Header.Set("Accept", ContentTypeJSON)
+	req.Header.Set("Origin", "https://www.youtube.com")
+	req.Header.Set("X-YouTube-Client-Name", strconv.Itoa(p.ID))
+	req.Header.Set("X-YouTube-Client-Version", p.Version)
+	if p.UserAgent != "" {
+		req.Header.Set("User-Agent", p.UserAgent)
+	}
+	return req, nil
+}
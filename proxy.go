@@ -0,0 +1,311 @@
+package yt
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// proxiedHeaders are the headers of upstream responses which the Handler
+// passes on to clients when it proxies a stream
+var proxiedHeaders = []string{"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges", "Last-Modified"}
+
+// A proxiedInfo is the info of a video whose streams the Handler is
+// proxying, which it keeps until the stream URLs expire.
+type proxiedInfo struct {
+	info    *Info
+	expires time.Time
+}
+
+// streamRoute parses the path of a request for a stream, /{id}/stream/{itag}
+func streamRoute(p string) (id string, itag int, ok bool) {
+	parts := strings.Split(strings.TrimPrefix(p, "/"), "/")
+	if len(parts) != 3 || parts[1] != "stream" {
+		return "", 0, false
+	}
+	itag, err := strconv.Atoi(parts[2])
+	if err != nil || itag <= 0 {
+		return "", 0, false
+	}
+	return parts[0], itag, true
+}
+
+// stream proxies the format of the video with the given itag from YouTube
+// (using the Handler's StreamingClient), passing on any Range. If YouTube
+// forbids it, the stream URL is assumed to have expired, and the info is
+// fetched again.
+func (h *Handler) stream(w http.ResponseWriter, r *http.Request, id string, itag int) {
+	if !InfoID.MatchString(id) {
+		h.error(w, http.StatusBadRequest)
+		return
+	}
+	c := h.StreamingClient
+	if c == nil {
+		c = DefaultHTTPClient
+	}
+
+	for attempt := 0; ; attempt++ {
+		info, err := h.proxied(r.Context(), id, attempt > 0)
+		if err != nil {
+			h.fail(w, err)
+			return
+		}
+		u, _, err := info.stream(itag)
+		if err != nil {
+			h.fail(w, err)
+			return
+		}
+		req, err := http.NewRequestWithContext(r.Context(), r.Method, u, nil)
+		if err != nil {
+			h.error(w, http.StatusBadGateway)
+			return
+		}
+		for _, k := range []string{"Range", "If-Range"} {
+			if v := r.Header.Get(k); v != "" {
+				req.Header.Set(k, v)
+			}
+		}
+		resp, err := c.Do(req)
+		if err != nil {
+			h.error(w, http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusForbidden && attempt == 0 {
+			continue
+		}
+		switch resp.StatusCode {
+		case http.StatusOK, http.StatusPartialContent, http.StatusRequestedRangeNotSatisfiable:
+		default:
+			h.error(w, http.StatusBadGateway)
+			return
+		}
+
+		for _, k := range proxiedHeaders {
+			if v := resp.Header.Get(k); v != "" {
+				w.Header().Set(k, v)
+			}
+		}
+		f := info.Format(itag)
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", f.MIMEType)
+		}
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+			"filename": filename(info, f),
+		}))
+		w.WriteHeader(resp.StatusCode)
+		if r.Method != http.MethodHead {
+			io.Copy(w, resp.Body)
+		}
+		return
+	}
+}
+
+// liveRoute parses the path of a request for a live video's playlist or
+// segment, /{id}/live
+func liveRoute(p string) (id string, ok bool) {
+	parts := strings.Split(strings.TrimPrefix(p, "/"), "/")
+	if len(parts) != 2 || parts[1] != "live" {
+		return "", false
+	}
+	return parts[0], true
+}
+
+// live proxies a playlist or segment of a live video from YouTube (using the
+// Handler's StreamingClient), passing on any Range. Its upstream URL is the u
+// parameter, which must have been signed by the Handler (see liveURI).
+// Playlists have their URIs rewritten to those of the proxy too.
+func (h *Handler) live(w http.ResponseWriter, r *http.Request, id string) {
+	if !InfoID.MatchString(id) {
+		h.error(w, http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	s := q.Get("u")
+	if !hmac.Equal([]byte(q.Get("s")), []byte(h.sign(id, s))) {
+		h.error(w, http.StatusForbidden)
+		return
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		h.error(w, http.StatusBadRequest)
+		return
+	}
+	c := h.StreamingClient
+	if c == nil {
+		c = DefaultHTTPClient
+	}
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, u.String(), nil)
+	if err != nil {
+		h.error(w, http.StatusBadGateway)
+		return
+	}
+	for _, k := range []string{"Range", "If-Range"} {
+		if v := r.Header.Get(k); v != "" {
+			req.Header.Set(k, v)
+		}
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		h.error(w, http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent, http.StatusRequestedRangeNotSatisfiable:
+	default:
+		h.error(w, http.StatusBadGateway)
+		return
+	}
+
+	if isPlaylist(u, resp) {
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			h.error(w, http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", ContentTypeHLS)
+		w.WriteHeader(resp.StatusCode)
+		w.Write(rewritePlaylist(u, data, func(u *url.URL) string {
+			return h.liveURI(id, "", u)
+		}))
+		return
+	}
+	for _, k := range proxiedHeaders {
+		if v := resp.Header.Get(k); v != "" {
+			w.Header().Set(k, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	if r.Method != http.MethodHead {
+		io.Copy(w, resp.Body)
+	}
+}
+
+// liveURI gets the URI of the Handler's proxy for the resource of the live
+// video with the given ID at u, relative to base
+func (h *Handler) liveURI(id, base string, u *url.URL) string {
+	s := u.String()
+	return base + "live?" + url.Values{"u": {s}, "s": {h.sign(id, s)}}.Encode()
+}
+
+// sign gets the signature with which the Handler's proxy accepts the URL s
+// of a resource of the live video with the given ID. It's made with the
+// SigningKey, or else a key which is random (so that it can't be forged),
+// and made when it's first needed.
+func (h *Handler) sign(id, s string) string {
+	key := h.SigningKey
+	if len(key) == 0 {
+		h.keyOnce.Do(func() {
+			h.key = make([]byte, 32)
+			if _, err := rand.Read(h.key); err != nil {
+				panic(err)
+			}
+		})
+		key = h.key
+	}
+	m := hmac.New(sha256.New, key)
+	fmt.Fprintf(m, "%s\n%s", id, s)
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+// isPlaylist checks whether a response from u is an HLS playlist (rather
+// than a segment)
+func isPlaylist(u *url.URL, resp *http.Response) bool {
+	t, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch strings.ToLower(t) {
+	case ContentTypeHLS, "application/x-mpegurl", "audio/mpegurl", "audio/x-mpegurl":
+		return true
+	}
+	return strings.HasSuffix(u.Path, ".m3u8")
+}
+
+// proxied gets the info of the video with the given id, from the Handler's
+// cache unless it has expired (or refresh is set, in which case its
+// InfoCache is bypassed too, and updated).
+func (h *Handler) proxied(ctx context.Context, id string, refresh bool) (*Info, error) {
+	h.mu.Lock()
+	p, ok := h.infos[id]
+	h.mu.Unlock()
+	if ok && !refresh && time.Now().Before(p.expires) {
+		return p.info, nil
+	}
+
+	info, err := h.get(ctx, id, refresh)
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	if h.infos == nil {
+		h.infos = map[string]*proxiedInfo{}
+	}
+	for k, p := range h.infos {
+		if now.After(p.expires) {
+			delete(h.infos, k)
+		}
+	}
+	h.infos[id] = &proxiedInfo{info, now.Add(info.ttl())}
+	return info, nil
+}
+
+// proxy gets a copy of info in which the URL of each format is that of the
+// Handler's proxy for it, relative to base.
+func proxy(info *Info, base string) *Info {
+	p := *info
+	if sd := info.StreamingData; sd != nil {
+		s := *sd
+		s.Formats = proxyFormats(sd.Formats, base)
+		s.AdaptiveFormats = proxyFormats(sd.AdaptiveFormats, base)
+		p.StreamingData = &s
+	}
+	return &p
+}
+
+// proxyFormats copies formats, replacing their URLs with those of the
+// Handler's proxy, relative to base
+func proxyFormats(formats []*Format, base string) []*Format {
+	var fs []*Format
+	for _, f := range formats {
+		c := *f
+		if c.URL != "" {
+			c.URL = base + "stream/" + strconv.Itoa(c.ITag)
+		}
+		fs = append(fs, &c)
+	}
+	return fs
+}
+
+// filename gets the name under which a client should save a format of a
+// video: its title (without any characters which aren't safe in file names)
+// or ID, and the format's itag and container.
+func filename(info *Info, f *Format) string {
+	name := "video"
+	if v := info.VideoDetails; v != nil {
+		if v.ID != "" {
+			name = v.ID
+		}
+		if t := strings.Map(func(r rune) rune {
+			if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+				return -1
+			}
+			return r
+		}, strings.TrimSpace(v.Title)); t != "" {
+			name = t
+		}
+	}
+	return name + "." + strconv.Itoa(f.ITag) + "." + f.Container
+}
@@ -0,0 +1,234 @@
+package yt
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandlerStream(t *testing.T) {
+	var version int
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		case r.URL.Path == "/forbidden":
+			w.WriteHeader(http.StatusForbidden)
+		case r.URL.Query().Get("v") != fmt.Sprint(version):
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.Header().Set("Content-Type", "video/mp4")
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader(testStream))
+		}
+	}))
+	defer upstream.Close()
+
+	fetches := map[string]int{}
+	withInfoServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := new(playerRequest)
+		json.NewDecoder(r.Body).Decode(body)
+		fetches[body.VideoID]++
+		w.Header().Set("Content-Type", ContentTypeJSON)
+		switch body.VideoID {
+		case "abcdefgh123":
+			fmt.Fprintf(w, `{"videoDetails":{"videoId":"abcdefgh123","title":"A/B: \"Cé\""},"streamingData":{"expiresInSeconds":"21540","adaptiveFormats":[
+				{"itag":137,"url":"%s/137?v=%d","mimeType":"video/mp4; codecs=\"avc1.640028\""},
+				{"itag":136,"url":"%s/forbidden","mimeType":"video/mp4; codecs=\"avc1.4d401f\""},
+				{"itag":140,"url":"%s/broken","mimeType":"audio/mp4; codecs=\"mp4a.40.2\""},
+				{"itag":141,"url":"%%zz","mimeType":"audio/mp4; codecs=\"mp4a.40.2\""},
+				{"itag":251,"url":"http://127.0.0.1:0/","mimeType":"audio/webm; codecs=\"opus\""}
+			]}}`, upstream.URL, version, upstream.URL, upstream.URL)
+		case "noexpiry123":
+			fmt.Fprintf(w, `{"videoDetails":{},"streamingData":{"formats":[{"itag":18,"url":"%s/18?v=%d","mimeType":"video/mp4; codecs=\"avc1.42001E, mp4a.40.2\""}]}}`, upstream.URL, version)
+		default:
+			fmt.Fprint(w, `{"playabilityStatus":{"status":"ERROR","reason":"Video unavailable"}}`)
+		}
+	}), func() {
+		cache := new(LRUInfoCache)
+		h := &Handler{StreamingClient: upstream.Client(), InfoCache: cache}
+		get := func(method, path, rng string) *http.Response {
+			req := httptest.NewRequest(method, path, nil)
+			if rng != "" {
+				req.Header.Set("Range", rng)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			return w.Result()
+		}
+
+		r := get(http.MethodGet, "/abcdefgh123/stream/137", "bytes=4-9")
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.StatusCode != http.StatusPartialContent || string(body) != testStream[4:10] {
+			t.Errorf("expected 206 with %q, got %d with %q", testStream[4:10], r.StatusCode, body)
+		}
+		if cr := r.Header.Get("Content-Range"); cr != fmt.Sprintf("bytes 4-9/%d", len(testStream)) {
+			t.Errorf("expected a Content-Range, got %q", cr)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "video/mp4" {
+			t.Errorf("expected the upstream Content-Type, got %q", ct)
+		}
+		if cd := r.Header.Get("Content-Disposition"); cd != `attachment; filename*=utf-8''AB%20C%C3%A9.137.mp4` {
+			t.Errorf("expected a Content-Disposition with the title, got %q", cd)
+		}
+
+		r = get(http.MethodGet, "/abcdefgh123/stream/137", "")
+		body, _ = ioutil.ReadAll(r.Body)
+		if r.StatusCode != http.StatusOK || string(body) != testStream {
+			t.Errorf("expected 200 with the whole stream, got %d with %q", r.StatusCode, body)
+		}
+		if n := fetches["abcdefgh123"]; n != 1 {
+			t.Errorf("expected the info to be fetched once, got %d", n)
+		}
+
+		version++
+		r = get(http.MethodHead, "/abcdefgh123/stream/137", "")
+		body, _ = ioutil.ReadAll(r.Body)
+		if r.StatusCode != http.StatusOK || len(body) != 0 {
+			t.Errorf("expected 200 with no body, got %d with %q", r.StatusCode, body)
+		}
+		if n := fetches["abcdefgh123"]; n != 2 {
+			t.Errorf("expected the info to be refreshed when the URL expired, got %d fetches", n)
+		}
+
+		for i := 0; i < 2; i++ {
+			r = get(http.MethodGet, "/noexpiry123/stream/18", "bytes=0-0")
+			if r.StatusCode != http.StatusPartialContent || r.Header.Get("Content-Type") != `video/mp4` {
+				t.Errorf("expected 206, got %d", r.StatusCode)
+			}
+			if cd := r.Header.Get("Content-Disposition"); cd != `attachment; filename=video.18.mp4` {
+				t.Errorf("expected a Content-Disposition, got %q", cd)
+			}
+		}
+		if n := fetches["noexpiry123"]; n != 2 {
+			t.Errorf("expected info without an expiry to be fetched every time, got %d", n)
+		}
+
+		for path, status := range map[string]int{
+			"/abcdefgh123/stream/140": http.StatusBadGateway,
+			"/abcdefgh123/stream/141": http.StatusBadGateway,
+			"/abcdefgh123/stream/251": http.StatusBadGateway,
+			"/abcdefgh123/stream/22":  http.StatusNotFound,
+			"/abcdefgh123/stream/x":   http.StatusNotFound,
+			"/missing1234/stream/18":  http.StatusNotFound,
+			"/abc/stream/18":          http.StatusBadRequest,
+		} {
+			if r := get(http.MethodGet, path, ""); r.StatusCode != status {
+				t.Errorf("GET %s: expected status %d, got %d", path, status, r.StatusCode)
+			}
+		}
+		n := fetches["abcdefgh123"]
+		if r := get(http.MethodGet, "/abcdefgh123/stream/136", ""); r.StatusCode != http.StatusBadGateway {
+			t.Errorf("expected a persistent 403 to be a bad gateway, got %d", r.StatusCode)
+		}
+		if fetches["abcdefgh123"] != n+1 {
+			t.Errorf("expected the info to be refreshed once on a 403")
+		}
+
+		n = fetches["abcdefgh123"]
+		h = &Handler{StreamingClient: upstream.Client(), InfoCache: cache}
+		if r := get(http.MethodGet, "/abcdefgh123", ""); r.StatusCode != http.StatusOK {
+			t.Errorf("expected 200, got %d", r.StatusCode)
+		}
+		if r := get(http.MethodGet, "/abcdefgh123/stream/137", ""); r.StatusCode != http.StatusOK {
+			t.Errorf("expected the refreshed info to be cached, got %d", r.StatusCode)
+		}
+		if fetches["abcdefgh123"] != n {
+			t.Errorf("expected the info to come from the InfoCache")
+		}
+	})
+}
+
+func TestHandlerLive(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/live/index.m3u8":
+			fmt.Fprint(w, "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1\n95/index.m3u8\n#EXT-X-STREAM-INF:BANDWIDTH=2\n96/index.m3u8\n")
+		case "/live/95/index.m3u8":
+			w.Header().Set("Content-Type", "application/x-mpegURL")
+			fmt.Fprint(w, "#EXTM3U\n#EXT-X-MEDIA-SEQUENCE:7\n#EXTINF:5.0,\nseg/7.ts\n")
+		case "/live/95/seg/7.ts":
+			w.Header().Set("Content-Type", "video/mp2t")
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader(testStream))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer upstream.Close()
+
+	withInfoServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentTypeJSON)
+		fmt.Fprintf(w, `{"videoDetails":{"isLiveContent":true},"streamingData":{"hlsManifestUrl":"%s/live/index.m3u8"}}`, upstream.URL)
+	}), func() {
+		h := &Handler{StreamingClient: upstream.Client()}
+		get := func(path, rng string) (*http.Response, string) {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			if rng != "" {
+				req.Header.Set("Range", rng)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			return w.Result(), w.Body.String()
+		}
+		// uri gets the last URI in a playlist
+		uri := func(playlist string) string {
+			lines := strings.Split(strings.TrimSpace(playlist), "\n")
+			return lines[len(lines)-1]
+		}
+
+		r, master := get("/livestream1.m3u8", "")
+		if r.StatusCode != http.StatusOK || strings.Contains(master, upstream.URL) {
+			t.Fatalf("expected a master playlist without upstream URLs, got %d with\n%s", r.StatusCode, master)
+		}
+		variant := strings.Split(master, "\n")[2]
+		if !strings.HasPrefix(variant, "livestream1/live?") {
+			t.Fatalf("expected the variant to be proxied, got %q", variant)
+		}
+		r, media := get("/"+variant, "")
+		if r.StatusCode != http.StatusOK || r.Header.Get("Content-Type") != ContentTypeHLS {
+			t.Fatalf("expected a media playlist, got %d (%s)", r.StatusCode, r.Header.Get("Content-Type"))
+		}
+		if !strings.Contains(media, "#EXTINF:5.0,\nlive?") || strings.Contains(media, upstream.URL) {
+			t.Fatalf("expected the segments to be proxied, got\n%s", media)
+		}
+		r, segment := get("/livestream1/"+uri(media), "bytes=2-5")
+		if r.StatusCode != http.StatusPartialContent || segment != testStream[2:6] || r.Header.Get("Content-Type") != "video/mp2t" {
+			t.Errorf("expected part of the segment, got %d (%s) with %q", r.StatusCode, r.Header.Get("Content-Type"), segment)
+		}
+
+		missing := strings.Replace(uri(master), "livestream1/", "/livestream1/", 1)
+		if r, _ := get(missing, ""); r.StatusCode != http.StatusBadGateway {
+			t.Errorf("expected a missing variant to be a bad gateway, got %d", r.StatusCode)
+		}
+		q, _ := url.ParseQuery(strings.SplitN(variant, "?", 2)[1])
+		for _, path := range []string{
+			"/livestream1/live?" + url.Values{"u": {"http://example.com/"}, "s": q["s"]}.Encode(),
+			"/livestream1/live?u=" + url.QueryEscape(q.Get("u")),
+			"/otherstream/" + variant[len("livestream1/"):],
+		} {
+			if r, _ := get(path, ""); r.StatusCode != http.StatusForbidden {
+				t.Errorf("expected %s to be forbidden, got %d", path, r.StatusCode)
+			}
+		}
+		if r, _ := get("/bad/live", ""); r.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected a bad ID to be a bad request, got %d", r.StatusCode)
+		}
+
+		h = &Handler{StreamingClient: upstream.Client(), SigningKey: []byte("secret")}
+		_, master = get("/livestream1.m3u8", "")
+		variant = strings.Split(master, "\n")[2]
+		h = &Handler{StreamingClient: upstream.Client(), SigningKey: []byte("secret")}
+		if r, _ := get("/"+variant, ""); r.StatusCode != http.StatusOK {
+			t.Errorf("expected another Handler with the same key to proxy the variant, got %d", r.StatusCode)
+		}
+		h = &Handler{StreamingClient: upstream.Client()}
+		if r, _ := get("/"+variant, ""); r.StatusCode != http.StatusForbidden {
+			t.Errorf("expected a Handler with a random key not to proxy the variant, got %d", r.StatusCode)
+		}
+	})
+}
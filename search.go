@@ -2,46 +2,241 @@ package yt
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
-// A Result is a result from a YouTube search; it can be either a video or a
-// channel.
+// SearchURL is the URL of the endpoint we search
+var SearchURL *url.URL
+
+// DefaultPerPage is the number of results fetched per page when a
+// SearchClient doesn't specify one.
+const DefaultPerPage = 25
+
+// A Result is a result from a YouTube search; it can be a video, a channel or
+// a playlist.
 type Result interface {
 	Type() string
 }
 
-// A SearchClient can search YouTube
+// A SearchClient can search YouTube. A zero SearchClient uses defaults. If
+// Timeout is set, it limits the time spent fetching each page of results. If
+// Failed is set, it's called when a page after the first fails.
 type SearchClient struct {
 	AuthFunc func() (string, error)
 	URL      *url.URL
 	PerPage  int
 	Timeout  time.Duration
 	Client   *http.Client
+	Failed   func(*PageError)
 }
 
-// AuthFunc is the default authorization function
+// AuthFunc is the default authorization function. It gets the credentials
+// of the DefaultTokenSource: an OAuth 2.0 access token, or an API key with
+// APIKeyPrefix, or "" if there are none (in which case requests aren't
+// authorized).
 var AuthFunc = func() (string, error) {
-	return "token", nil
+	return DefaultTokenSource.Auth()
+}
+
+// A PageError is the error which stops a listing (of search results,
+// playlist entries or uploads) when a page after the first fails. It's given
+// to the client's Failed function, so that a truncated listing can be told
+// from a complete one. Page counts from 1.
+type PageError struct {
+	Page int
+	Err  error
+}
+
+// Error implements error
+func (e *PageError) Error() string {
+	return fmt.Sprintf("page %d: %v", e.Page, e.Err)
 }
 
-// Get searches YouTube for videos and channels
+// Unwrap gets the underlying error
+func (e *PageError) Unwrap() error {
+	return e.Err
+}
+
+// Get searches YouTube for videos, channels and playlists. The first page of
+// results is fetched before Get returns, so bad requests are reported
+// immediately; the rest are fetched as the channel is drained, following the
+// continuation token of each page until there are no more results, a page
+// fails, or the context is done. If a page fails, the client's Failed function
+// is called (before the channel is closed) with a *PageError. The channel is
+// closed when it has no more results.
+//
+// The details which search results lack (such as durations, view counts and
+// subscriber counts) are filled in with a single lookup per page.
 func (c *SearchClient) Get(ctx context.Context, query string) (chan Result, error) {
-	f := c.AuthFunc
-	if f == nil {
-		f = AuthFunc
+	page, results, err := c.page(ctx, query, "")
+	if err != nil {
+		return nil, err
 	}
 	ch := make(chan Result)
 	go func(ch chan Result) {
 		defer close(ch)
-		ch <- &Video{}
+		for n := 2; ; n++ {
+			for _, r := range results {
+				select {
+				case ch <- r:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if page.NextPageToken == "" {
+				return
+			}
+			if page, results, err = c.page(ctx, query, page.NextPageToken); err != nil {
+				if ctx.Err() == nil && c.Failed != nil {
+					c.Failed(&PageError{n, err})
+				}
+				return
+			}
+		}
 	}(ch)
 	return ch, nil
 }
 
-// Search searches YouTube for videos and channels.
+// page fetches a single page of search results, and their details
+func (c *SearchClient) page(ctx context.Context, query, token string) (*searchPage, []Result, error) {
+	n := c.PerPage
+	if n <= 0 {
+		n = DefaultPerPage
+	}
+	q := url.Values{}
+	q.Set("part", "snippet")
+	q.Set("q", query)
+	q.Set("maxResults", strconv.Itoa(n))
+	if token != "" {
+		q.Set("pageToken", token)
+	}
+	page := new(searchPage)
+	if err := c.api().fetch(ctx, "", q, page); err != nil {
+		return nil, nil, err
+	}
+
+	var results []Result
+	videos := map[string]*Video{}
+	channels := map[string]*Channel{}
+	playlists := map[string]*Playlist{}
+	var videoIDs, channelIDs, playlistIDs []string
+	for _, item := range page.Items {
+		switch item.ID.Kind {
+		case "youtube#video":
+			v := item.video()
+			videos[v.ID] = v
+			videoIDs = append(videoIDs, v.ID)
+			results = append(results, v)
+		case "youtube#channel":
+			ch := item.channel()
+			channels[ch.ID] = ch
+			channelIDs = append(channelIDs, ch.ID)
+			results = append(results, ch)
+		case "youtube#playlist":
+			p := item.playlist()
+			playlists[p.ID] = p
+			playlistIDs = append(playlistIDs, p.ID)
+			results = append(results, p)
+		}
+	}
+
+	a := c.api()
+	if err := a.videos(ctx, videoIDs, videos); err != nil {
+		return nil, nil, err
+	}
+	if err := a.channels(ctx, channelIDs, channels); err != nil {
+		return nil, nil, err
+	}
+	if err := a.playlists(ctx, playlistIDs, playlists); err != nil {
+		return nil, nil, err
+	}
+
+	return page, results, nil
+}
+
+// api gets the api used by the SearchClient, with defaults filled in
+func (c *SearchClient) api() *api {
+	a := &api{c.AuthFunc, c.URL, c.Timeout, c.Client}
+	if a.auth == nil {
+		a.auth = AuthFunc
+	}
+	if a.url == nil {
+		a.url = SearchURL
+	}
+	if a.client == nil {
+		a.client = DefaultHTTPClient
+	}
+	return a
+}
+
+// A searchPage is a single page of results from the search endpoint
+type searchPage struct {
+	NextPageToken string        `json:"nextPageToken"`
+	Items         []*searchItem `json:"items"`
+}
+
+// A searchItem is a single search result, as returned by the search endpoint
+type searchItem struct {
+	ID struct {
+		Kind       string `json:"kind"`
+		VideoID    string `json:"videoId"`
+		ChannelID  string `json:"channelId"`
+		PlaylistID string `json:"playlistId"`
+	} `json:"id"`
+	Snippet *snippet `json:"snippet"`
+}
+
+// video converts the item to a Video
+func (i *searchItem) video() *Video {
+	v := &Video{ID: i.ID.VideoID}
+	if s := i.Snippet; s != nil {
+		v.Title = s.Title
+		v.ChannelID = s.ChannelID
+		v.ChannelName = s.ChannelTitle
+		v.Published = s.PublishedAt
+		v.Thumbnails = s.thumbnails()
+	}
+	return v
+}
+
+// channel converts the item to a Channel
+func (i *searchItem) channel() *Channel {
+	ch := &Channel{ID: i.ID.ChannelID}
+	if strings.HasPrefix(ch.ID, "UC") {
+		ch.UploadsPlaylistID = "UU" + ch.ID[2:]
+	}
+	if s := i.Snippet; s != nil {
+		ch.Title = s.Title
+		if ts := s.thumbnails(); len(ts) > 0 {
+			ch.Avatar = ts[len(ts)-1]
+		}
+	}
+	return ch
+}
+
+// playlist converts the item to a Playlist
+func (i *searchItem) playlist() *Playlist {
+	p := &Playlist{ID: i.ID.PlaylistID}
+	if s := i.Snippet; s != nil {
+		p.Title = s.Title
+		p.ChannelID = s.ChannelID
+		p.ChannelName = s.ChannelTitle
+		p.Published = s.PublishedAt
+		p.Thumbnails = s.thumbnails()
+	}
+	return p
+}
+
+// Search searches YouTube for videos, channels and playlists.
 func Search(ctx context.Context, query string) (chan Result, error) {
-	return new(SearchClient).Search(ctx, query)
+	return new(SearchClient).Get(ctx, query)
+}
+
+func init() {
+	SearchURL, _ = url.Parse("https://www.googleapis.com/youtube/v3/search")
 }
@@ -2,20 +2,227 @@ package yt
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 )
 
 func TestSearch(t *testing.T) {
-	rs, err := Search(context.Background(), "foo")
+	defer func(s *TokenSource) { DefaultTokenSource = s }(DefaultTokenSource)
+	DefaultTokenSource = &TokenSource{token: &Token{AccessToken: "token"}}
+	withSearchServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "Bearer token" {
+			t.Errorf("expected Authorization %q, got %q", "Bearer token", auth)
+		}
+		q := r.URL.Query()
+		w.Header().Set("Content-Type", ContentTypeJSON)
+		switch r.URL.Path {
+		case "/videos":
+			fmt.Fprint(w, `{"items":[
+				{"id":"aaaaaaaaaaa","contentDetails":{"duration":"PT1H2M3S"},"statistics":{"viewCount":"42"}}
+			]}`)
+			return
+		case "/channels":
+			fmt.Fprint(w, `{"items":[
+				{"id":"UCxxxxxxxxxx","contentDetails":{"relatedPlaylists":{"uploads":"UUyyyy"}},"statistics":{"subscriberCount":"7"}}
+			]}`)
+			return
+		case "/playlists":
+			fmt.Fprint(w, `{"items":[{"id":"PLzzzzzzzzzz","contentDetails":{"itemCount":12}}]}`)
+			return
+		}
+		if q.Get("q") != "foo" {
+			t.Errorf("expected q to be %q, got %q", "foo", q.Get("q"))
+		}
+		if q.Get("maxResults") != "25" {
+			t.Errorf("expected maxResults to be %q, got %q", "25", q.Get("maxResults"))
+		}
+		switch q.Get("pageToken") {
+		case "":
+			fmt.Fprint(w, `{"nextPageToken":"p2","items":[
+				{"id":{"kind":"youtube#video","videoId":"aaaaaaaaaaa"},"snippet":{
+					"publishedAt":"2020-05-01T12:00:00Z","channelId":"UCxxxxxxxxxx","channelTitle":"X","title":"A",
+					"thumbnails":{"high":{"url":"h","width":480},"default":{"url":"d","width":120}}
+				}},
+				{"id":{"kind":"youtube#unknown"}}
+			]}`)
+		case "p2":
+			fmt.Fprint(w, `{"items":[
+				{"id":{"kind":"youtube#video","videoId":"bbbbbbbbbbb"}},
+				{"id":{"kind":"youtube#channel","channelId":"UCxxxxxxxxxx"},"snippet":{
+					"title":"X","thumbnails":{"default":{"url":"d","width":88},"medium":{"url":"m","width":240}}
+				}},
+				{"id":{"kind":"youtube#playlist","playlistId":"PLzzzzzzzzzz"},"snippet":{
+					"title":"Z","channelId":"UCxxxxxxxxxx","channelTitle":"X"
+				}}
+			]}`)
+		default:
+			t.Errorf("unexpected pageToken %q", q.Get("pageToken"))
+		}
+	}), func() {
+		rs, err := Search(context.Background(), "foo")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		var results []Result
+		for r := range rs {
+			results = append(results, r)
+		}
+		if len(results) != 4 {
+			t.Fatalf("expected four results from two pages, got %d", len(results))
+		}
+
+		v, ok := results[0].(*Video)
+		if !ok || v.Type() != "video" {
+			t.Fatalf("expected results[0] to be a video, got %#v", results[0])
+		}
+		if v.ID != "aaaaaaaaaaa" || v.Title != "A" || v.ChannelID != "UCxxxxxxxxxx" || v.ChannelName != "X" {
+			t.Errorf("unexpected video %#v", v)
+		}
+		if v.Duration != time.Hour+2*time.Minute+3*time.Second {
+			t.Errorf("expected video duration to be 1h2m3s, got %s", v.Duration)
+		}
+		if v.Views != 42 {
+			t.Errorf("expected video views to be 42, got %d", v.Views)
+		}
+		if !v.Published.Equal(time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)) {
+			t.Errorf("unexpected publish time %s", v.Published)
+		}
+		if len(v.Thumbnails) != 2 || v.Thumbnails[0].URL != "d" || v.Thumbnails[1].URL != "h" {
+			t.Errorf("expected thumbnails smallest first, got %v", v.Thumbnails)
+		}
+
+		if v := results[1].(*Video); v.ID != "bbbbbbbbbbb" || v.Duration != 0 {
+			t.Errorf("unexpected video %#v", v)
+		}
+
+		c, ok := results[2].(*Channel)
+		if !ok || c.Type() != "channel" {
+			t.Fatalf("expected results[2] to be a channel, got %#v", results[2])
+		}
+		if c.ID != "UCxxxxxxxxxx" || c.Title != "X" || c.Subscribers != 7 || c.UploadsPlaylistID != "UUyyyy" {
+			t.Errorf("unexpected channel %#v", c)
+		}
+		if c.Avatar == nil || c.Avatar.URL != "m" {
+			t.Errorf("expected the largest avatar, got %v", c.Avatar)
+		}
+
+		p, ok := results[3].(*Playlist)
+		if !ok || p.Type() != "playlist" {
+			t.Fatalf("expected results[3] to be a playlist, got %#v", results[3])
+		}
+		if p.ID != "PLzzzzzzzzzz" || p.Title != "Z" || p.ChannelID != "UCxxxxxxxxxx" || p.ChannelName != "X" || p.ItemCount != 12 {
+			t.Errorf("unexpected playlist %#v", p)
+		}
+	})
+}
+
+func TestSearchClient(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			t.Errorf("expected no Authorization, got %q", auth)
+		}
+		switch r.URL.Path {
+		case "/videos":
+			if r.URL.Query().Get("id") == "bad" {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			fmt.Fprint(w, `{"items":[]}`)
+			return
+		case "/channels", "/playlists":
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		switch r.URL.Query().Get("q") {
+		case "playlist":
+			fmt.Fprint(w, `{"items":[{"id":{"kind":"youtube#playlist","playlistId":"PLx"}}]}`)
+		case "video":
+			fmt.Fprint(w, `{"items":[{"id":{"kind":"youtube#video","videoId":"bad"}}]}`)
+		case "channel":
+			fmt.Fprint(w, `{"items":[{"id":{"kind":"youtube#channel","channelId":"UCx"}}]}`)
+		case "fail":
+			w.WriteHeader(http.StatusForbidden)
+		case "junk":
+			fmt.Fprint(w, `{`)
+		case "more":
+			if r.URL.Query().Get("pageToken") != "" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			fmt.Fprint(w, `{"nextPageToken":"x","items":[{"id":{"kind":"youtube#video"}}]}`)
+		default:
+			fmt.Fprint(w, `{"nextPageToken":"x","items":[{"id":{"kind":"youtube#video"}},{"id":{"kind":"youtube#video"}}]}`)
+		}
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	c := &SearchClient{
+		AuthFunc: func() (string, error) { return "", nil },
+		URL:      u,
+		PerPage:  2,
+		Timeout:  time.Second,
+		Client:   ts.Client(),
+	}
+
+	for _, q := range []string{"fail", "junk", "video", "channel", "playlist"} {
+		if _, err := c.Get(context.Background(), q); err == nil {
+			t.Errorf("expected an error searching for %q", q)
+		}
+	}
+
+	var e *PageError
+	c.Failed = func(err *PageError) { e = err }
+	rs, err := c.Get(context.Background(), "more")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	n := 0
+	for range rs {
+		n++
+	}
+	if n != 1 {
+		t.Errorf("expected results to stop at a failed page, got %d", n)
+	}
+	var se *StatusError
+	if e == nil || e.Page != 2 || !errors.As(e, &se) || se.StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected page 2 to fail with 500, got %v", e)
+	}
+
+	e = nil
+	ctx, cancel := context.WithCancel(context.Background())
+	rs, err = c.Get(ctx, "forever")
 	if err != nil {
-		t.Fatalf("expected no error, got %e", err)
+		t.Fatalf("expected no error, got %v", err)
 	}
-	if cap(rs) != 1 {
-		t.Fatalf("expected %d results, got %d", 1, len(rs))
+	<-rs
+	cancel()
+	for range rs {
 	}
-	r := <-rs
-	x := r.Type()
-	if x != "video" {
-		t.Errorf("expected results[0].Type to be %q, got %q", "video", x)
+	if e != nil {
+		t.Errorf("expected no page error after cancelling, got %v", e)
 	}
+
+	c.AuthFunc = func() (string, error) { return "", errors.New("no auth") }
+	if _, err := c.Get(context.Background(), "foo"); err == nil {
+		t.Errorf("expected an auth error")
+	}
+
+	c.AuthFunc = nil
+	c.URL = &url.URL{Scheme: "http", Host: "%zz"}
+	if _, err := c.Get(context.Background(), "foo"); err == nil {
+		t.Errorf("expected a URL error")
+	}
+}
+
+func withSearchServer(h http.Handler, f func()) {
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	defer func(u *url.URL) { SearchURL = u }(SearchURL)
+	SearchURL = u
+	f()
 }
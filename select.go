@@ -0,0 +1,292 @@
+package yt
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SelectFormat picks formats from info with a format selection expression.
+// An expression is a list of alternatives separated by slashes, the first of
+// which to match is chosen; an alternative is a selector, or two selectors
+// joined by a plus (to be merged, such as a video and an audio stream); and a
+// selector is one of best, worst, bestvideo, worstvideo, bestaudio,
+// worstaudio (or b, w, bv, wv, ba, wa) or an itag, followed by any number of
+// filters in brackets. For example:
+//
+//	bestvideo[height<=1080][ext=mp4]+bestaudio/best
+//
+// Filters compare a field with a value. The numeric fields are height,
+// width, fps, bitrate and itag, and they can be compared with =, !=, <, <=,
+// > and >=. The string fields are ext, vcodec, acodec, quality and
+// projection, and they can be compared with = and !=, or matched with ^=
+// (starts with), $= (ends with) and *= (contains).
+//
+// The best and worst formats have both video and audio; the best videos are
+// the tallest, then the smoothest, then the highest bitrate, and the best
+// audio has the highest bitrate.
+func SelectFormat(info *Info, expr string) ([]*Format, error) {
+	alts, err := parseSelection(expr)
+	if err != nil {
+		return nil, err
+	}
+	formats := info.Formats()
+	for _, alt := range alts {
+		var picked []*Format
+		for _, s := range alt {
+			f := s.pick(formats)
+			if f == nil {
+				picked = nil
+				break
+			}
+			picked = append(picked, f)
+		}
+		if picked != nil {
+			return picked, nil
+		}
+	}
+	return nil, fmt.Errorf("%w matches %q", ErrNoFormat, expr)
+}
+
+// number gets the value of a numeric field of a format
+func number(f *Format, field string) (int, bool) {
+	switch field {
+	case "height":
+		return f.Height, true
+	case "width":
+		return f.Width, true
+	case "fps":
+		return f.FPS, true
+	case "bitrate":
+		return f.Bitrate, true
+	case "itag":
+		return f.ITag, true
+	}
+	return 0, false
+}
+
+// text gets the value of a string field of a format
+func text(f *Format, field string) (string, bool) {
+	switch field {
+	case "ext":
+		return f.Container, true
+	case "vcodec":
+		return f.VideoCodec(), true
+	case "acodec":
+		return f.AudioCodec(), true
+	case "quality":
+		return f.Quality, true
+	case "projection":
+		return f.ProjectionType, true
+	}
+	return "", false
+}
+
+// A selector picks the best (or worst) of the formats of some kind which pass
+// all of its filters.
+type selector struct {
+	kind    string
+	worst   bool
+	itag    int
+	filters []*filter
+}
+
+// pick chooses a format, or nil if none will do
+func (s *selector) pick(formats []*Format) *Format {
+	var cs []*Format
+	for _, f := range formats {
+		if s.accepts(f) {
+			cs = append(cs, f)
+		}
+	}
+	if len(cs) == 0 {
+		return nil
+	}
+	sort.SliceStable(cs, func(i, j int) bool {
+		a, b := cs[i], cs[j]
+		if s.kind != "audio" {
+			if a.Height != b.Height {
+				return a.Height > b.Height
+			}
+			if a.FPS != b.FPS {
+				return a.FPS > b.FPS
+			}
+		}
+		return a.Bitrate > b.Bitrate
+	})
+	if s.worst {
+		return cs[len(cs)-1]
+	}
+	return cs[0]
+}
+
+// accepts checks whether f is of the selector's kind, and passes its filters
+func (s *selector) accepts(f *Format) bool {
+	switch s.kind {
+	case "itag":
+		if f.ITag != s.itag {
+			return false
+		}
+	case "video":
+		if !f.IsVideo() || f.IsAudio() {
+			return false
+		}
+	case "audio":
+		if !f.IsAudio() || f.IsVideo() {
+			return false
+		}
+	default:
+		if !f.IsVideo() || !f.IsAudio() {
+			return false
+		}
+	}
+	for _, x := range s.filters {
+		if !x.accepts(f) {
+			return false
+		}
+	}
+	return true
+}
+
+// A filter compares a field of a format with a value
+type filter struct {
+	field, op, value string
+}
+
+// accepts checks whether the format passes the filter
+func (f *filter) accepts(x *Format) bool {
+	if n, ok := number(x, f.field); ok {
+		v, _ := strconv.Atoi(f.value)
+		switch f.op {
+		case "=":
+			return n == v
+		case "!=":
+			return n != v
+		case "<":
+			return n < v
+		case "<=":
+			return n <= v
+		case ">":
+			return n > v
+		case ">=":
+			return n >= v
+		}
+	}
+	s, _ := text(x, f.field)
+	switch f.op {
+	case "=":
+		return s == f.value
+	case "!=":
+		return s != f.value
+	case "^=":
+		return strings.HasPrefix(s, f.value)
+	case "$=":
+		return strings.HasSuffix(s, f.value)
+	case "*=":
+		return strings.Contains(s, f.value)
+	}
+	return false
+}
+
+// selectors maps the names of selectors to their kind, and whether they
+// pick the worst
+var selectors = map[string]selector{
+	"best":       {kind: "both"},
+	"b":          {kind: "both"},
+	"worst":      {kind: "both", worst: true},
+	"w":          {kind: "both", worst: true},
+	"bestvideo":  {kind: "video"},
+	"bv":         {kind: "video"},
+	"worstvideo": {kind: "video", worst: true},
+	"wv":         {kind: "video", worst: true},
+	"bestaudio":  {kind: "audio"},
+	"ba":         {kind: "audio"},
+	"worstaudio": {kind: "audio", worst: true},
+	"wa":         {kind: "audio", worst: true},
+}
+
+// parseSelection parses a format selection expression into alternatives,
+// each of which is a list of selectors to be merged.
+func parseSelection(expr string) ([][]*selector, error) {
+	var alts [][]*selector
+	for _, alt := range strings.Split(strings.Replace(expr, " ", "", -1), "/") {
+		parts := strings.Split(alt, "+")
+		if len(parts) > 2 {
+			return nil, fmt.Errorf("too many formats to merge in %q", alt)
+		}
+		var sels []*selector
+		for _, part := range parts {
+			s, err := parseSelector(part)
+			if err != nil {
+				return nil, err
+			}
+			sels = append(sels, s)
+		}
+		alts = append(alts, sels)
+	}
+	return alts, nil
+}
+
+// filterOps are the operators which filters may use, longest first
+var filterOps = []string{"!=", "<=", ">=", "^=", "$=", "*=", "=", "<", ">"}
+
+// numericOps and textOps are the operators which apply to numeric and string
+// fields
+var (
+	numericOps = map[string]bool{"=": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+	textOps    = map[string]bool{"=": true, "!=": true, "^=": true, "$=": true, "*=": true}
+)
+
+// parseSelector parses a selector, with its filters
+func parseSelector(s string) (*selector, error) {
+	name := s
+	if i := strings.IndexByte(s, '['); i >= 0 {
+		name = s[:i]
+	}
+	sel, ok := selectors[name]
+	if !ok {
+		itag, err := strconv.Atoi(name)
+		if err != nil {
+			return nil, fmt.Errorf("unknown format %q", name)
+		}
+		sel = selector{kind: "itag", itag: itag}
+	}
+
+	rest := s[len(name):]
+	for rest != "" {
+		end := strings.IndexByte(rest, ']')
+		if rest[0] != '[' || end < 0 {
+			return nil, fmt.Errorf("invalid filter %q", rest)
+		}
+		f, err := parseFilter(rest[1:end])
+		if err != nil {
+			return nil, err
+		}
+		sel.filters = append(sel.filters, f)
+		rest = rest[end+1:]
+	}
+	return &sel, nil
+}
+
+// parseFilter parses a filter such as height<=1080
+func parseFilter(s string) (*filter, error) {
+	for _, op := range filterOps {
+		i := strings.Index(s, op)
+		if i <= 0 {
+			continue
+		}
+		f := &filter{s[:i], op, s[i+len(op):]}
+		if _, ok := number(new(Format), f.field); ok {
+			if _, err := strconv.Atoi(f.value); err != nil || !numericOps[op] {
+				return nil, fmt.Errorf("invalid numeric filter %q", s)
+			}
+			return f, nil
+		}
+		if _, ok := text(new(Format), f.field); ok && textOps[op] {
+			return f, nil
+		}
+		return nil, fmt.Errorf("invalid filter %q", s)
+	}
+	return nil, fmt.Errorf("invalid filter %q", s)
+}
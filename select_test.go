@@ -0,0 +1,86 @@
+package yt
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+const testFormats = `{"streamingData":{
+	"formats":[
+		{"itag":18,"mimeType":"video/mp4; codecs=\"avc1.42001E, mp4a.40.2\"","width":640,"height":360,"fps":30,"bitrate":500000,"quality":"medium"},
+		{"itag":22,"mimeType":"video/mp4; codecs=\"avc1.64001F, mp4a.40.2\"","width":1280,"height":720,"fps":30,"bitrate":1500000,"quality":"hd720"}
+	],
+	"adaptiveFormats":[
+		{"itag":137,"mimeType":"video/mp4; codecs=\"avc1.640028\"","width":1920,"height":1080,"fps":30,"bitrate":4000000,"quality":"hd1080"},
+		{"itag":299,"mimeType":"video/mp4; codecs=\"avc1.64002a\"","width":1920,"height":1080,"fps":60,"bitrate":6000000,"quality":"hd1080"},
+		{"itag":313,"mimeType":"video/webm; codecs=\"vp9\"","width":3840,"height":2160,"fps":30,"bitrate":18000000,"quality":"hd2160"},
+		{"itag":315,"mimeType":"video/webm; codecs=\"vp9\"","width":3840,"height":2160,"fps":30,"bitrate":20000000,"quality":"hd2160","projectionType":"MESH"},
+		{"itag":140,"mimeType":"audio/mp4; codecs=\"mp4a.40.2\"","bitrate":130000},
+		{"itag":251,"mimeType":"audio/webm; codecs=\"opus\"","bitrate":160000},
+		{"itag":249,"mimeType":"audio/webm; codecs=\"opus\"","bitrate":50000},
+		{"itag":0,"mimeType":"bogus"}
+	]
+}}`
+
+func TestSelectFormat(t *testing.T) {
+	info := new(Info)
+	if err := json.Unmarshal([]byte(testFormats), info); err != nil {
+		t.Fatal(err)
+	}
+	for expr, x := range map[string]string{
+		"best":                 "[22]",
+		"worst":                "[18]",
+		"bestvideo":            "[315]",
+		"bv[projection!=MESH]": "[313]",
+		"bestvideo[height<=1080][ext=mp4]+bestaudio":         "[299 251]",
+		"bestvideo[height<=1080][fps<60]+ba[ext=mp4]":        "[137 140]",
+		"worstvideo+worstaudio":                              "[137 249]",
+		"wv[vcodec^=vp]+wa[acodec$=2]":                       "[313 140]",
+		"bv[vcodec*=64002a]":                                 "[299]",
+		"bv[height>2160]/bv[height>=2160][bitrate<20000000]": "[313]",
+		"bestaudio[acodec=flac]/best[height=360]":            "[18]",
+		"b[quality=medium]/w":                                "[18]",
+		"bv[width>1920][itag!=315]":                          "[313]",
+		"140":                                                "[140]",
+		"137 + 140":                                          "[137 140]",
+		"best[height>1080]/w[fps>30]/140[bitrate>1]":         "[140]",
+		"bv[width=1920][fps=60]":                             "[299]",
+	} {
+		formats, err := SelectFormat(info, expr)
+		if err != nil {
+			t.Errorf("expected no error selecting %q, got %v", expr, err)
+			continue
+		}
+		var itags []int
+		for _, f := range formats {
+			itags = append(itags, f.ITag)
+		}
+		if fmt.Sprint(itags) != x {
+			t.Errorf("expected %q to select %s, got %v", expr, x, itags)
+		}
+	}
+
+	for _, expr := range []string{
+		"",
+		"greatest",
+		"best+bv+ba",
+		"best[height",
+		"best[height<=high]",
+		"best[ext<mp4]",
+		"best[colour=red]",
+		"best[=red]",
+		"best[height]",
+		"best[height^=1]",
+		"best]",
+		"bv[height>2160]",
+		"1",
+	} {
+		if _, err := SelectFormat(info, expr); err == nil {
+			t.Errorf("expected an error selecting %q", expr)
+		}
+	}
+	if _, err := SelectFormat(new(Info), "best"); err == nil {
+		t.Errorf("expected an error selecting from info without formats")
+	}
+}
@@ -0,0 +1,185 @@
+package yt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// APIKeyPrefix marks a credential from an AuthFunc as an API key (to be sent
+// as the key parameter) rather than an OAuth 2.0 access token (to be sent as
+// a bearer token).
+const APIKeyPrefix = "key:"
+
+// DefaultTokenSource is the TokenSource used by the default AuthFunc. It has
+// no credentials, so requests aren't authorized unless it's given some.
+var DefaultTokenSource = new(TokenSource)
+
+// A TokenSource gets the credentials for requests to YouTube: OAuth 2.0
+// access tokens, if it has one which is valid, or a refresh token (its
+// RefreshToken, or that of the token saved in its File), or can Authorize
+// (with a DeviceAuth, say), or else its APIKey. Access tokens are cached until they expire, and refreshed
+// (once, however many callers need them at the time) with its ClientID and
+// ClientSecret. If it has a File, its token is kept there, so that it can
+// be used again by other processes. Its Auth method can be used as an
+// AuthFunc. A zero TokenSource has no credentials.
+type TokenSource struct {
+	APIKey       string
+	ClientID     string
+	ClientSecret string
+	RefreshToken string
+	TokenURL     *url.URL
+	HTTP         *http.Client
+	File         string
+	Authorize    func(context.Context) (*Token, error)
+
+	mu      sync.Mutex
+	loaded  bool
+	token   *Token
+	refresh *tokenRefresh
+}
+
+// A tokenRefresh is a refresh of a TokenSource's token which is in flight,
+// or has finished (when done is closed)
+type tokenRefresh struct {
+	done  chan struct{}
+	token *Token
+	err   error
+}
+
+// Auth gets the credentials for a request: an access token, or (if there's
+// no valid token, and no way to get one) an API key with APIKeyPrefix, or ""
+// if there are none.
+func (s *TokenSource) Auth() (string, error) {
+	s.mu.Lock()
+	s.load()
+	oauth := s.token.Valid() || s.refreshToken(s.token) != "" || s.Authorize != nil
+	s.mu.Unlock()
+	if !oauth {
+		if s.APIKey != "" {
+			return APIKeyPrefix + s.APIKey, nil
+		}
+		return "", nil
+	}
+	t, err := s.Token(context.Background())
+	if err != nil {
+		return "", err
+	}
+	return t.AccessToken, nil
+}
+
+// Token gets a valid OAuth 2.0 token, refreshing (or getting) it if it
+// needs to. Callers which need it at the same time share the refresh; a
+// caller whose context is done stops waiting for it.
+func (s *TokenSource) Token(ctx context.Context) (*Token, error) {
+	s.mu.Lock()
+	s.load()
+	if s.token.Valid() {
+		t := s.token
+		s.mu.Unlock()
+		return t, nil
+	}
+	r := s.refresh
+	if r == nil {
+		r = &tokenRefresh{done: make(chan struct{})}
+		s.refresh = r
+		go s.renew(r, s.token)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-r.done:
+		return r.token, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// renew gets a new token to replace old (which may be nil), using its
+// refresh token, or by authorizing, and saves it.
+func (s *TokenSource) renew(r *tokenRefresh, old *Token) {
+	ctx := context.Background()
+	refreshToken := s.refreshToken(old)
+	switch {
+	case refreshToken != "":
+		r.token, r.err = oauthExchange(ctx, s.HTTP, s.TokenURL, url.Values{
+			"client_id":     {s.ClientID},
+			"client_secret": {s.ClientSecret},
+			"refresh_token": {refreshToken},
+			"grant_type":    {"refresh_token"},
+		})
+		if r.err == nil && r.token.RefreshToken == "" {
+			r.token.RefreshToken = refreshToken
+		}
+	case s.Authorize != nil:
+		r.token, r.err = s.Authorize(ctx)
+	default:
+		r.err = errors.New("no refresh token")
+	}
+
+	s.mu.Lock()
+	if r.err == nil {
+		s.token = r.token
+		s.save()
+	}
+	s.refresh = nil
+	s.mu.Unlock()
+	close(r.done)
+}
+
+// refreshToken gets the refresh token with which to replace t (which may be
+// nil): its own, or else the RefreshToken
+func (s *TokenSource) refreshToken(t *Token) string {
+	if t != nil && t.RefreshToken != "" {
+		return t.RefreshToken
+	}
+	return s.RefreshToken
+}
+
+// load loads the token from the File, if it hasn't been loaded already. It
+// must be called with s.mu locked.
+func (s *TokenSource) load() {
+	if s.loaded || s.File == "" {
+		return
+	}
+	s.loaded = true
+	data, err := ioutil.ReadFile(s.File)
+	if err != nil {
+		return
+	}
+	t := new(Token)
+	if err := json.Unmarshal(data, t); err == nil && (t.AccessToken != "" || t.RefreshToken != "") {
+		s.token = t
+	}
+}
+
+// save writes the token to the File (if it has one), replacing it
+// atomically, so that other processes never see it half-written. It must
+// be called with s.mu locked. Since the token has been got anyway, errors
+// are ignored.
+func (s *TokenSource) save() {
+	if s.File == "" {
+		return
+	}
+	if data, err := json.Marshal(s.token); err == nil {
+		writeFile(s.File, data)
+	}
+}
+
+// authorize sets the credentials from an AuthFunc on a request: as the key
+// parameter, for an API key, or else as a bearer token.
+func authorize(req *http.Request, auth string) {
+	switch {
+	case strings.HasPrefix(auth, APIKeyPrefix):
+		q := req.URL.Query()
+		q.Set("key", strings.TrimPrefix(auth, APIKeyPrefix))
+		req.URL.RawQuery = q.Encode()
+	case auth != "":
+		req.Header.Set("Authorization", "Bearer "+auth)
+	}
+}
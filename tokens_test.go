@@ -0,0 +1,171 @@
+package yt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeRefreshServer is a local OAuth 2.0 token endpoint, which refreshes the
+// "refresh" token (slowly, so that callers pile up), and counts how many
+// times it has.
+func fakeRefreshServer(t *testing.T, refreshes *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		w.Header().Set("Content-Type", ContentTypeJSON)
+		if r.Form.Get("grant_type") != "refresh_token" || r.Form.Get("client_id") != "client" || r.Form.Get("client_secret") != "secret" {
+			t.Errorf("unexpected token request %v", r.Form)
+		}
+		if r.Form.Get("refresh_token") != "refresh" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"invalid_grant","error_description":"Bad Request"}`)
+			return
+		}
+		n := atomic.AddInt32(refreshes, 1)
+		time.Sleep(10 * time.Millisecond)
+		fmt.Fprintf(w, `{"access_token":"access%d","expires_in":3599,"token_type":"Bearer"}`, n)
+	}))
+}
+
+func TestTokenSource(t *testing.T) {
+	var refreshes int32
+	ts := fakeRefreshServer(t, &refreshes)
+	defer ts.Close()
+	tokenURL, _ := url.Parse(ts.URL)
+	dir, err := ioutil.TempDir("", "yt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "token.json")
+
+	s := &TokenSource{ClientID: "client", ClientSecret: "secret", RefreshToken: "refresh", TokenURL: tokenURL, File: file, APIKey: "unused"}
+	var wg sync.WaitGroup
+	auths := make([]string, 20)
+	for i := range auths {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			auths[i], _ = s.Auth()
+		}(i)
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&refreshes); n != 1 {
+		t.Errorf("expected concurrent callers to share one refresh, got %d", n)
+	}
+	for _, a := range auths {
+		if a != "access1" {
+			t.Errorf("expected the refreshed access token, got %q", a)
+		}
+	}
+	if a, _ := s.Auth(); a != "access1" || atomic.LoadInt32(&refreshes) != 1 {
+		t.Errorf("expected the access token to be cached, got %q", a)
+	}
+
+	saved := new(Token)
+	data, _ := ioutil.ReadFile(file)
+	if err := json.Unmarshal(data, saved); err != nil || saved.AccessToken != "access1" || saved.RefreshToken != "refresh" || !saved.Valid() {
+		t.Errorf("expected the token to be saved, got %s", data)
+	}
+	if names := dirNames(dir); fmt.Sprint(names) != "[token.json]" {
+		t.Errorf("expected only the token file to be left, got %v", names)
+	}
+
+	// another process, with only the file
+	other := &TokenSource{ClientID: "client", ClientSecret: "secret", TokenURL: tokenURL, File: file}
+	if a, err := other.Auth(); err != nil || a != "access1" || atomic.LoadInt32(&refreshes) != 1 {
+		t.Errorf("expected the saved token, got %q (%v)", a, err)
+	}
+	saved.Expiry = time.Now().Add(-time.Minute)
+	data, _ = json.Marshal(saved)
+	ioutil.WriteFile(file, data, 0600)
+	other = &TokenSource{ClientID: "client", ClientSecret: "secret", TokenURL: tokenURL, File: file}
+	if a, err := other.Auth(); err != nil || a != "access2" {
+		t.Errorf("expected the saved refresh token to be used, got %q (%v)", a, err)
+	}
+
+	bad := &TokenSource{ClientID: "client", ClientSecret: "secret", RefreshToken: "revoked", TokenURL: tokenURL}
+	var e *AuthError
+	if _, err := bad.Auth(); !errors.As(err, &e) || e.Code != "invalid_grant" {
+		t.Errorf("expected the grant to be invalid, got %v", err)
+	}
+	if bad.refresh != nil || bad.token != nil {
+		t.Errorf("expected a failed refresh to be forgotten")
+	}
+}
+
+func TestTokenSourceCredentials(t *testing.T) {
+	if a, err := new(TokenSource).Auth(); a != "" || err != nil {
+		t.Errorf("expected no credentials, got %q (%v)", a, err)
+	}
+	if a, _ := (&TokenSource{APIKey: "abc"}).Auth(); a != "key:abc" {
+		t.Errorf("expected the API key, got %q", a)
+	}
+	if a, _ := (&TokenSource{APIKey: "abc", File: "/nonexistent/token.json"}).Auth(); a != "key:abc" {
+		t.Errorf("expected the API key without a saved token, got %q", a)
+	}
+	if _, err := new(TokenSource).Token(context.Background()); err == nil {
+		t.Errorf("expected an error getting a token without a refresh token")
+	}
+
+	var authorized int
+	s := &TokenSource{Authorize: func(context.Context) (*Token, error) {
+		authorized++
+		return &Token{AccessToken: "device", RefreshToken: "r", Expiry: time.Now().Add(time.Hour)}, nil
+	}, File: filepath.Join(os.TempDir(), "nonexistent", "token.json")}
+	if a, err := s.Auth(); err != nil || a != "device" || authorized != 1 {
+		t.Errorf("expected the token from authorizing, got %q (%v)", a, err)
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+	s = &TokenSource{Authorize: func(ctx context.Context) (*Token, error) {
+		<-release
+		return nil, errors.New("too late")
+	}}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := s.Token(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected the deadline to be exceeded, got %v", err)
+	}
+
+	file := filepath.Join(os.TempDir(), fmt.Sprintf("yt-token-%d.json", os.Getpid()))
+	defer os.Remove(file)
+	ioutil.WriteFile(file, []byte(`{}`), 0600)
+	if a, _ := (&TokenSource{APIKey: "abc", File: file}).Auth(); a != "key:abc" {
+		t.Errorf("expected an empty saved token to be ignored, got %q", a)
+	}
+	ioutil.WriteFile(file, []byte(`{"access_token":"old","expiry":"2000-01-01T00:00:00Z"}`), 0600)
+	if a, err := (&TokenSource{APIKey: "abc", File: file}).Auth(); a != "key:abc" || err != nil {
+		t.Errorf("expected an expired token which can't be refreshed to fall back to the API key, got %q (%v)", a, err)
+	}
+	ioutil.WriteFile(file, []byte(`{"access_token":"saved"}`), 0600)
+	if a, _ := (&TokenSource{APIKey: "abc", File: file}).Auth(); a != "saved" {
+		t.Errorf("expected a valid saved token to be used, got %q", a)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	for auth, expected := range map[string]string{
+		"":        "/?a=b ",
+		"access":  "/?a=b Bearer access",
+		"key:abc": "/?a=b&key=abc ",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/?a=b", nil)
+		authorize(req, auth)
+		if got := req.URL.RequestURI() + " " + req.Header.Get("Authorization"); got != expected {
+			t.Errorf("%q: expected %q, got %q", auth, expected, got)
+		}
+	}
+}
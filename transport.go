@@ -0,0 +1,207 @@
+package yt
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The defaults of a RetryTransport
+const (
+	DefaultMaxRetries = 3
+	DefaultMinBackoff = 500 * time.Millisecond
+	DefaultMaxBackoff = 30 * time.Second
+)
+
+// A RetryTransport is a http.RoundTripper which retries requests (using its
+// Base, or http.DefaultTransport) which are rejected with 429 Too Many
+// Requests or a 5xx status, up to MaxRetries times. It backs off
+// exponentially from MinBackoff to MaxBackoff, with jitter, or for as long as
+// a Retry-After header says (unless that's longer than MaxBackoff, in which
+// case the response is returned). If it has a Limiter, every attempt waits
+// for it. Requests whose bodies can't be replayed aren't retried. A zero
+// RetryTransport uses defaults; a negative MaxRetries means none. To use one
+// with a client (such as an InfoClient, or a Handler's clients), give it a
+// http.Client with the RetryTransport as its Transport; clients which share
+// a RetryTransport share its Limiter.
+type RetryTransport struct {
+	Base       http.RoundTripper
+	MaxRetries int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	Limiter    *HostLimiter
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	retries := t.MaxRetries
+	switch {
+	case retries == 0:
+		retries = DefaultMaxRetries
+	case retries < 0:
+		retries = 0
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		retries = 0
+	}
+
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		if t.Limiter != nil {
+			if err := t.Limiter.Wait(ctx, req.URL.Host); err != nil {
+				return nil, err
+			}
+		}
+		r := req
+		if attempt > 0 {
+			r = req.Clone(ctx)
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				r.Body = body
+			}
+		}
+		resp, err := base.RoundTrip(r)
+		if err != nil || attempt >= retries || !retryable(resp.StatusCode) {
+			return resp, err
+		}
+		d, ok := t.backoff(attempt, resp.Header.Get("Retry-After"))
+		if !ok {
+			return resp, nil
+		}
+		io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+		resp.Body.Close()
+		if err := sleep(ctx, d); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// backoff gets how long to wait before retrying after the given attempt
+// (counting from 0), or false if the Retry-After header asks for longer than
+// MaxBackoff.
+func (t *RetryTransport) backoff(attempt int, retryAfter string) (time.Duration, bool) {
+	min, max := t.MinBackoff, t.MaxBackoff
+	if min <= 0 {
+		min = DefaultMinBackoff
+	}
+	if max <= 0 {
+		max = DefaultMaxBackoff
+	}
+	if retryAfter != "" {
+		if s, err := strconv.Atoi(retryAfter); err == nil && s >= 0 {
+			d := time.Duration(s) * time.Second
+			return d, d <= max
+		}
+		if at, err := http.ParseTime(retryAfter); err == nil {
+			d := time.Until(at)
+			if d < 0 {
+				d = 0
+			}
+			return d, d <= max
+		}
+	}
+	d := min
+	for i := 0; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	// wait somewhere between half and all of it
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1)), true
+}
+
+// retryable checks whether a response status means the request may succeed
+// if it's retried
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// sleep waits for d, or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// A HostLimiter limits the rate of requests to each host to Rate per second,
+// with bursts of up to Burst (at least 1), using a token bucket for each
+// host. A zero Rate means no limit. It's safe for concurrent use.
+type HostLimiter struct {
+	Rate  float64
+	Burst int
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// A tokenBucket holds the tokens available for requests to a host, as of
+// when it was last updated
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Wait waits until a request may be made to host, or until ctx is done.
+func (l *HostLimiter) Wait(ctx context.Context, host string) error {
+	if l.Rate <= 0 {
+		return nil
+	}
+	burst := float64(l.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	if l.buckets == nil {
+		l.buckets = map[string]*tokenBucket{}
+	}
+	for h, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.Rate >= burst {
+			delete(l.buckets, h) // it's full, so it's as good as new
+		}
+	}
+	b, ok := l.buckets[host]
+	if !ok {
+		b = &tokenBucket{tokens: burst, last: now}
+		l.buckets[host] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.Rate
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+	// take a token, even if it isn't there yet, and wait until it is
+	b.tokens--
+	d := time.Duration(-b.tokens / l.Rate * float64(time.Second))
+	l.mu.Unlock()
+
+	if d <= 0 {
+		return nil
+	}
+	if err := sleep(ctx, d); err != nil {
+		l.mu.Lock()
+		b.tokens++
+		l.mu.Unlock()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package yt
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryTransport(t *testing.T) {
+	var attempts []string
+	statuses := map[string][]int{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		attempts = append(attempts, string(body))
+		s := statuses[r.URL.Path]
+		status := s[0]
+		if len(s) > 1 {
+			statuses[r.URL.Path] = s[1:]
+		}
+		switch r.URL.Path {
+		case "/later":
+			w.Header().Set("Retry-After", "0")
+		case "/date":
+			w.Header().Set("Retry-After", time.Now().UTC().Format(http.TimeFormat))
+		case "/never":
+			w.Header().Set("Retry-After", "3600")
+		}
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	c := &http.Client{Transport: &RetryTransport{MinBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}}
+	for _, tc := range []struct {
+		path     string
+		statuses []int
+		status   int
+		attempts int
+	}{
+		{"/flaky", []int{503, 500, 200}, 200, 3},
+		{"/busy", []int{429}, 429, 4},
+		{"/later", []int{429, 200}, 200, 2},
+		{"/date", []int{503, 200}, 200, 2},
+		{"/never", []int{429, 200}, 429, 1},
+		{"/missing", []int{404}, 404, 1},
+	} {
+		attempts, statuses[tc.path] = nil, tc.statuses
+		resp, err := c.Post(ts.URL+tc.path, "text/plain", strings.NewReader("body"))
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", tc.path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.status || len(attempts) != tc.attempts {
+			t.Errorf("%s: expected %d after %d attempts, got %d after %d", tc.path, tc.status, tc.attempts, resp.StatusCode, len(attempts))
+		}
+		for _, a := range attempts {
+			if a != "body" {
+				t.Errorf("%s: expected the body to be replayed, got %q", tc.path, a)
+			}
+		}
+	}
+
+	attempts, statuses["/flaky"] = nil, []int{503, 200}
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/flaky", ioutil.NopCloser(strings.NewReader("body")))
+	if resp, err := c.Do(req); err != nil || resp.StatusCode != 503 || len(attempts) != 1 {
+		t.Errorf("expected a body which can't be replayed not to be retried, got %v", err)
+	}
+	attempts, statuses["/flaky"] = nil, []int{503, 200}
+	none := &http.Client{Transport: &RetryTransport{MaxRetries: -1}}
+	if resp, err := none.Get(ts.URL + "/flaky"); err != nil || resp.StatusCode != 503 || len(attempts) != 1 {
+		t.Errorf("expected no retries, got %v", err)
+	}
+
+	statuses["/busy"] = []int{503}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	slow := &http.Client{Transport: &RetryTransport{MinBackoff: time.Hour, MaxBackoff: time.Hour}}
+	req, _ = http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/busy", nil)
+	if _, err := slow.Do(req); err == nil {
+		t.Errorf("expected an error when the context is done while backing off")
+	}
+	if _, err := c.Get("http://127.0.0.1:0/"); err == nil {
+		t.Errorf("expected a connection error")
+	}
+}
+
+func TestRetryTransportBackoff(t *testing.T) {
+	tr := new(RetryTransport)
+	for attempt, max := range []time.Duration{DefaultMinBackoff, 2 * DefaultMinBackoff, 4 * DefaultMinBackoff} {
+		if d, ok := tr.backoff(attempt, ""); !ok || d < max/2 || d > max {
+			t.Errorf("attempt %d: expected a backoff between %v and %v, got %v", attempt, max/2, max, d)
+		}
+	}
+	if d, _ := tr.backoff(20, ""); d > DefaultMaxBackoff {
+		t.Errorf("expected the backoff to be at most %v, got %v", DefaultMaxBackoff, d)
+	}
+	for header, ok := range map[string]bool{
+		"5": true, "31": false, "soon": true,
+		time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat): true,
+		time.Now().Add(time.Hour).UTC().Format(http.TimeFormat):  false,
+	} {
+		if _, got := tr.backoff(0, header); got != ok {
+			t.Errorf("Retry-After %q: expected %v, got %v", header, ok, got)
+		}
+	}
+}
+
+func TestHostLimiter(t *testing.T) {
+	ctx := context.Background()
+	if err := new(HostLimiter).Wait(ctx, "a"); err != nil {
+		t.Errorf("expected no limit, got %v", err)
+	}
+
+	l := &HostLimiter{Rate: 100, Burst: 2}
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		l.Wait(ctx, "a")
+	}
+	l.Wait(ctx, "b")
+	if d := time.Since(start); d < 15*time.Millisecond {
+		t.Errorf("expected a burst of 2 and then 100 per second, took %v", d)
+	}
+
+	l = &HostLimiter{Rate: 1}
+	l.Wait(ctx, "a")
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx, "a"); err == nil {
+		t.Errorf("expected an error when the context is done")
+	}
+	if b := l.buckets["a"]; b.tokens < -0.01 {
+		t.Errorf("expected the token to be returned, got %v", b.tokens)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	c := &http.Client{Transport: &RetryTransport{Limiter: l}}
+	if resp, err := c.Get(ts.URL); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the first request to be allowed, got %v", err)
+	}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL, nil)
+	if _, err := c.Do(req); err == nil {
+		t.Errorf("expected an error when the limiter's context is done")
+	}
+}
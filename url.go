@@ -0,0 +1,150 @@
+package yt
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Handle is the regular expression which channel @handles must match
+var Handle *regexp.Regexp
+
+// A Ref is a reference to a video, playlist or channel, as parsed from a URL.
+// A video may be referenced along with the playlist it was found in, and a
+// start offset. The ChannelID may be a channel ID, a @handle, a legacy /user/
+// name or a /c/ custom name, as accepted by ChannelClient.Resolve.
+type Ref struct {
+	VideoID    string
+	PlaylistID string
+	ChannelID  string
+	Start      time.Duration
+}
+
+// Type gets the type of thing referenced by the Ref; "video", "playlist" or
+// "channel".
+func (r Ref) Type() string {
+	switch {
+	case r.VideoID != "":
+		return "video"
+	case r.PlaylistID != "":
+		return "playlist"
+	}
+	return "channel"
+}
+
+// ParseURL parses a YouTube URL (or bare ID or @handle) into a Ref. It
+// understands watch URLs, youtu.be short links, /shorts/, /embed/, /live/,
+// music.youtube.com, playlist list= parameters, channel URLs (/channel/,
+// /user/, /c/ and @handles) and timestamps (t=1m30s, t=90 or start=90). A
+// timestamp which can't be parsed is ignored, since the URL is still good.
+func ParseURL(s string) (Ref, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case InfoID.MatchString(s):
+		return Ref{VideoID: s}, nil
+	case PlaylistID.MatchString(s):
+		return Ref{PlaylistID: s}, nil
+	case ChannelID.MatchString(s), Handle.MatchString(s):
+		return Ref{ChannelID: s}, nil
+	}
+
+	if !strings.Contains(s, "://") {
+		s = "https://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return Ref{}, err
+	}
+	q := u.Query()
+	path := strings.Split(strings.Trim(u.Path, "/"), "/")
+	arg := func(i int) string {
+		if i < len(path) {
+			return path[i]
+		}
+		return ""
+	}
+
+	var r Ref
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	switch strings.TrimPrefix(host, "m.") {
+	case "youtu.be":
+		r.VideoID = arg(0)
+	case "youtube.com", "music.youtube.com", "youtube-nocookie.com":
+		switch arg(0) {
+		case "watch":
+			r.VideoID = q.Get("v")
+		case "shorts", "embed", "live", "v":
+			if arg(1) != "videoseries" {
+				r.VideoID = arg(1)
+			}
+		case "playlist":
+		case "channel":
+			r.ChannelID = arg(1)
+		case "user", "c":
+			r.ChannelID = "/" + arg(0) + "/" + arg(1)
+		default:
+			if strings.HasPrefix(arg(0), "@") {
+				r.ChannelID = arg(0)
+			}
+		}
+	default:
+		return Ref{}, fmt.Errorf("unrecognized URL %q", s)
+	}
+
+	if r.VideoID != "" && !InfoID.MatchString(r.VideoID) {
+		return Ref{}, fmt.Errorf("invalid video ID %q in %q", r.VideoID, s)
+	}
+	if list := q.Get("list"); PlaylistID.MatchString(list) {
+		r.PlaylistID = list
+	}
+	if r.ChannelID != "" && !isChannel(r.ChannelID) {
+		return Ref{}, fmt.Errorf("invalid channel %q in %q", r.ChannelID, s)
+	}
+	if r.VideoID == "" && r.PlaylistID == "" && r.ChannelID == "" {
+		return Ref{}, fmt.Errorf("unrecognized URL %q", s)
+	}
+
+	t := q.Get("t")
+	if t == "" {
+		t = q.Get("start")
+	}
+	if t == "" {
+		if f, err := url.ParseQuery(u.Fragment); err == nil {
+			t = f.Get("t")
+		}
+	}
+	if t != "" {
+		r.Start, _ = parseTimestamp(t)
+	}
+	return r, nil
+}
+
+// isChannel checks whether s is a channel ID, @handle, /user/ name or /c/
+// custom name
+func isChannel(s string) bool {
+	return ChannelID.MatchString(s) || Handle.MatchString(s) ||
+		strings.HasPrefix(s, "/user/") && len(s) > len("/user/") ||
+		strings.HasPrefix(s, "/c/") && len(s) > len("/c/")
+}
+
+// timestamp matches timestamps in URLs, such as 1h2m3s
+var timestamp = regexp.MustCompile(`^(\d+h)?(\d+m)?(\d+s)?$`)
+
+// parseTimestamp parses a timestamp from a URL, which is either a number of
+// seconds or a duration such as 1m30s.
+func parseTimestamp(s string) (time.Duration, error) {
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 {
+		return time.Duration(n) * time.Second, nil
+	}
+	if s == "" || !timestamp.MatchString(s) {
+		return 0, fmt.Errorf("invalid timestamp %q", s)
+	}
+	return time.ParseDuration(s)
+}
+
+func init() {
+	Handle = regexp.MustCompile(`^@([[:word:]]|[.-]){3,30}$`)
+}
@@ -0,0 +1,91 @@
+package yt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseURL(t *testing.T) {
+	for s, x := range map[string]Ref{
+		"aqz-KE-bpKQ":              {VideoID: "aqz-KE-bpKQ"},
+		"PLxxxxxxxxxxxxxxxx":       {PlaylistID: "PLxxxxxxxxxxxxxxxx"},
+		"UCxxxxxxxxxxxxxxxxxxxxxx": {ChannelID: "UCxxxxxxxxxxxxxxxxxxxxxx"},
+		"@someone":                 {ChannelID: "@someone"},
+		"https://www.youtube.com/watch?v=aqz-KE-bpKQ":                           {VideoID: "aqz-KE-bpKQ"},
+		"https://m.youtube.com/watch?v=aqz-KE-bpKQ&t=1m30s":                     {VideoID: "aqz-KE-bpKQ", Start: 90 * time.Second},
+		"youtube.com/watch?v=aqz-KE-bpKQ&list=PLxxxxxxxxxxxxxxxx&index=2":       {VideoID: "aqz-KE-bpKQ", PlaylistID: "PLxxxxxxxxxxxxxxxx"},
+		"https://youtube.com/watch?v=aqz-KE-bpKQ&list=WL":                       {VideoID: "aqz-KE-bpKQ"},
+		"https://music.youtube.com/watch?v=aqz-KE-bpKQ":                         {VideoID: "aqz-KE-bpKQ"},
+		"https://youtu.be/aqz-KE-bpKQ?t=90":                                     {VideoID: "aqz-KE-bpKQ", Start: 90 * time.Second},
+		"https://www.youtube.com/shorts/aqz-KE-bpKQ":                            {VideoID: "aqz-KE-bpKQ"},
+		"https://www.youtube.com/embed/aqz-KE-bpKQ?start=5":                     {VideoID: "aqz-KE-bpKQ", Start: 5 * time.Second},
+		"https://www.youtube-nocookie.com/embed/videoseries?list=PLxxxxxxxxxxx": {PlaylistID: "PLxxxxxxxxxxx"},
+		"https://www.youtube.com/live/aqz-KE-bpKQ#t=1h2m3s":                     {VideoID: "aqz-KE-bpKQ", Start: time.Hour + 2*time.Minute + 3*time.Second},
+		"https://www.youtube.com/playlist?list=PLxxxxxxxxxxxxxxxx":              {PlaylistID: "PLxxxxxxxxxxxxxxxx"},
+		"https://www.youtube.com/channel/UCxxxxxxxxxxxxxxxxxxxxxx":              {ChannelID: "UCxxxxxxxxxxxxxxxxxxxxxx"},
+		"https://www.youtube.com/@someone/videos":                               {ChannelID: "@someone"},
+		"https://www.youtube.com/user/someone":                                  {ChannelID: "/user/someone"},
+		"https://www.youtube.com/c/SomeOne/videos":                              {ChannelID: "/c/SomeOne"},
+		"https://www.youtube.com/watch?v=aqz-KE-bpKQ&t=soon":                    {VideoID: "aqz-KE-bpKQ"},
+		"https://youtu.be/aqz-KE-bpKQ?t=1m30":                                   {VideoID: "aqz-KE-bpKQ"},
+	} {
+		r, err := ParseURL(s)
+		if err != nil {
+			t.Errorf("expected no error parsing %q, got %v", s, err)
+			continue
+		}
+		if r != x {
+			t.Errorf("expected %q to parse as %#v, got %#v", s, x, r)
+		}
+	}
+
+	for _, s := range []string{
+		"",
+		"https://example.com/watch?v=aqz-KE-bpKQ",
+		"https://youtu.be/short",
+		"https://www.youtube.com/channel/nope",
+		"https://www.youtube.com/user/",
+		"https://www.youtube.com/c/",
+		"https://www.youtube.com/feed/trending",
+		"http://[::1",
+	} {
+		if _, err := ParseURL(s); err == nil {
+			t.Errorf("expected an error parsing %q", s)
+		}
+	}
+}
+
+func TestRefType(t *testing.T) {
+	for x, r := range map[string]Ref{
+		"video":    {VideoID: "a", PlaylistID: "b"},
+		"playlist": {PlaylistID: "b"},
+		"channel":  {ChannelID: "c"},
+	} {
+		if r.Type() != x {
+			t.Errorf("expected %#v to be a %s, got %s", r, x, r.Type())
+		}
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	for s, d := range map[string]time.Duration{
+		"90":      90 * time.Second,
+		"1m30s":   90 * time.Second,
+		"2h":      2 * time.Hour,
+		"":        -1,
+		"-5":      -1,
+		"1.5m":    -1,
+		"forever": -1,
+	} {
+		x, err := parseTimestamp(s)
+		if d < 0 {
+			if err == nil {
+				t.Errorf("expected an error parsing %q", s)
+			}
+			continue
+		}
+		if err != nil || x != d {
+			t.Errorf("expected %q to parse as %s, got %s (%v)", s, d, x, err)
+		}
+	}
+}
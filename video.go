@@ -1,9 +1,56 @@
 package yt
 
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
 // A Video contains information about a YouTube video
-type Video struct{}
+type Video struct {
+	ID          string        `json:"id"`
+	Title       string        `json:"title"`
+	ChannelID   string        `json:"channelId"`
+	ChannelName string        `json:"channelName"`
+	Duration    time.Duration `json:"duration"`
+	Views       int64         `json:"views"`
+	Published   time.Time     `json:"published"`
+	Thumbnails  []*Thumbnail  `json:"thumbnails"`
+}
 
 // Type implements Result
 func (v *Video) Type() string {
 	return "video"
 }
+
+// A Thumbnail is an image representing a video, channel or playlist
+type Thumbnail struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// isoDuration matches ISO 8601 durations, such as PT1H2M3S
+var isoDuration = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// parseISODuration parses an ISO 8601 duration, as used by the API for video
+// lengths.
+func parseISODuration(s string) (time.Duration, error) {
+	m := isoDuration.FindStringSubmatch(s)
+	if m == nil || s == "P" || s == "PT" {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	var d time.Duration
+	for i, unit := range []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if m[i+1] == "" {
+			continue
+		}
+		n, err := strconv.ParseFloat(m[i+1], 64)
+		if err != nil {
+			return 0, err
+		}
+		d += time.Duration(n * float64(unit))
+	}
+	return d, nil
+}
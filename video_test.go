@@ -1 +1,33 @@
 package yt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseISODuration(t *testing.T) {
+	for s, d := range map[string]time.Duration{
+		"PT4M13S":  4*time.Minute + 13*time.Second,
+		"PT1H":     time.Hour,
+		"P1DT2S":   24*time.Hour + 2*time.Second,
+		"PT1.5S":   1500 * time.Millisecond,
+		"P0D":      0,
+		"":         -1,
+		"P":        -1,
+		"PT":       -1,
+		"1H":       -1,
+		"PT1H2M3X": -1,
+		"PTXS":     -1,
+	} {
+		x, err := parseISODuration(s)
+		if d < 0 {
+			if err == nil {
+				t.Errorf("expected an error parsing %q", s)
+			}
+			continue
+		}
+		if err != nil || x != d {
+			t.Errorf("expected %q to parse as %s, got %s (%v)", s, d, x, err)
+		}
+	}
+}
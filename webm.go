@@ -0,0 +1,354 @@
+package yt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// The IDs of the WebM (EBML) elements which the muxer cares about
+const (
+	ebmlHeaderID    = 0x1A45DFA3
+	segmentID       = 0x18538067
+	infoID          = 0x1549A966
+	timecodeScaleID = 0x2AD7B1
+	tracksID        = 0x1654AE6B
+	trackEntryID    = 0xAE
+	trackNumberID   = 0xD7
+	trackUIDID      = 0x73C5
+	clusterID       = 0x1F43B675
+	timecodeID      = 0xE7
+	simpleBlockID   = 0xA3
+	blockGroupID    = 0xA0
+	blockID         = 0xA1
+)
+
+// An ebmlElement is an element of a WebM file: its ID, and its contents
+type ebmlElement struct {
+	id   uint32
+	data []byte
+}
+
+// vintLen gets the length of the EBML variable-length integer which starts
+// with the byte b, or 0 if b can't start one.
+func vintLen(b byte) int {
+	for n := 1; n <= 8; n++ {
+		if b&(0x80>>uint(n-1)) != 0 {
+			return n
+		}
+	}
+	return 0
+}
+
+// vintValue gets the value of an EBML variable-length integer (without its
+// length marker), and whether it's reserved to mean "unknown".
+func vintValue(b []byte) (uint64, bool) {
+	v := uint64(b[0] & (0xFF >> uint(len(b))))
+	for _, c := range b[1:] {
+		v = v<<8 | uint64(c)
+	}
+	return v, v == 1<<uint(7*len(b))-1
+}
+
+// putVint writes v into b as an EBML variable-length integer of len(b) bytes
+func putVint(b []byte, v uint64) {
+	v |= 1 << uint(7*len(b))
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i], v = byte(v), v>>8
+	}
+}
+
+// readVint reads the bytes of an EBML variable-length integer from r
+func readVint(r io.Reader) ([]byte, error) {
+	b := make([]byte, 1, 8)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	n := vintLen(b[0])
+	if n == 0 {
+		return nil, errors.New("invalid EBML integer")
+	}
+	b = b[:n]
+	if _, err := io.ReadFull(r, b[1:]); err != nil {
+		return nil, unexpected(err)
+	}
+	return b, nil
+}
+
+// readElementHeader reads the header of the next element from r, returning
+// its ID, the size of its contents (or -1, if that's unknown), and the
+// header's length. It returns io.EOF if there are no more elements.
+func readElementHeader(r io.Reader) (uint32, int64, int, error) {
+	id, err := readVint(r)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if len(id) > 4 {
+		return 0, 0, 0, errors.New("invalid EBML element ID")
+	}
+	size, err := readVint(r)
+	if err != nil {
+		return 0, 0, 0, unexpected(err)
+	}
+	n, unknown := vintValue(size)
+	if unknown {
+		return uint32(decodeUint(id)), -1, len(id) + len(size), nil
+	}
+	return uint32(decodeUint(id)), int64(n), len(id) + len(size), nil
+}
+
+// parseElements splits data into elements. The elements share data, so
+// changing them changes it.
+func parseElements(data []byte) ([]*ebmlElement, error) {
+	var elements []*ebmlElement
+	for len(data) > 0 {
+		id, size, n, err := readElementHeader(bytes.NewReader(data))
+		if err != nil {
+			return nil, unexpected(err)
+		}
+		if size < 0 || size > int64(len(data)-n) {
+			return nil, fmt.Errorf("invalid size of EBML element %X", id)
+		}
+		elements = append(elements, &ebmlElement{id, data[n : n+int(size)]})
+		data = data[n+int(size):]
+	}
+	return elements, nil
+}
+
+// findElement finds the first element with the given ID
+func findElement(elements []*ebmlElement, id uint32) *ebmlElement {
+	for _, e := range elements {
+		if e.id == id {
+			return e
+		}
+	}
+	return nil
+}
+
+// encodeElement builds an element with the given ID and contents
+func encodeElement(id uint32, data []byte) []byte {
+	n := 1
+	for uint64(len(data)) >= 1<<uint(7*n)-1 {
+		n++
+	}
+	b := encodeUint(uint64(id))
+	size := make([]byte, n)
+	putVint(size, uint64(len(data)))
+	b = append(b, size...)
+	return append(b, data...)
+}
+
+// encodeUint encodes an unsigned integer in as few bytes as it needs
+func encodeUint(v uint64) []byte {
+	var b []byte
+	for {
+		b = append([]byte{byte(v)}, b...)
+		if v >>= 8; v == 0 {
+			return b
+		}
+	}
+}
+
+// decodeUint decodes a big-endian unsigned integer
+func decodeUint(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+// A webmHeader is the beginning of a WebM file: its EBML header, and the
+// info and tracks of its segment.
+type webmHeader struct {
+	ebml          []byte
+	info          []byte
+	track         []*ebmlElement
+	timecodeScale uint64
+}
+
+// parseWebMHeader parses the init range of a WebM stream
+func parseWebMHeader(init []byte) (*webmHeader, error) {
+	r := bytes.NewReader(init)
+	id, size, n, err := readElementHeader(r)
+	if err != nil || id != ebmlHeaderID || size < 0 || int64(n)+size > int64(len(init)) {
+		return nil, errors.New("WebM stream has no EBML header")
+	}
+	h := &webmHeader{ebml: init[:int64(n)+size], timecodeScale: 1000000}
+	r.Seek(size, io.SeekCurrent)
+	if id, _, _, err = readElementHeader(r); err != nil || id != segmentID {
+		return nil, errors.New("WebM stream has no segment")
+	}
+	children, err := parseElements(init[len(init)-r.Len():])
+	if err != nil {
+		return nil, err
+	}
+	info, tracks := findElement(children, infoID), findElement(children, tracksID)
+	if info == nil || tracks == nil {
+		return nil, errors.New("WebM stream has no info or tracks")
+	}
+	h.info = info.data
+	fields, err := parseElements(info.data)
+	if err != nil {
+		return nil, err
+	}
+	if s := findElement(fields, timecodeScaleID); s != nil {
+		h.timecodeScale = decodeUint(s.data)
+	}
+	entries, err := parseElements(tracks.data)
+	if err != nil {
+		return nil, err
+	}
+	entry := findElement(entries, trackEntryID)
+	if entry == nil {
+		return nil, errors.New("WebM stream has no track")
+	}
+	if h.track, err = parseElements(entry.data); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// trackNumber gets the number of the header's track
+func (h *webmHeader) trackNumber() uint64 {
+	if n := findElement(h.track, trackNumberID); n != nil {
+		return decodeUint(n.data)
+	}
+	return 0
+}
+
+// trackEntry builds the header's track entry, renumbered n
+func (h *webmHeader) trackEntry(n uint64) []byte {
+	var b []byte
+	for _, e := range h.track {
+		switch e.id {
+		case trackNumberID, trackUIDID:
+			b = append(b, encodeElement(e.id, encodeUint(n))...)
+		default:
+			b = append(b, encodeElement(e.id, e.data)...)
+		}
+	}
+	return encodeElement(trackEntryID, b)
+}
+
+// muxWebM writes a WebM file with the video and audio tracks. Its segment
+// has the video's info, and the video's track (renumbered 1) and the audio's
+// (renumbered 2); its clusters are interleaved. The segment's size is left
+// unknown, and it has no cues, since they'd need to be known in advance.
+func muxWebM(w *countingWriter, v, a *muxTrack) error {
+	vh, err := parseWebMHeader(v.init)
+	if err != nil {
+		return err
+	}
+	ah, err := parseWebMHeader(a.init)
+	if err != nil {
+		return err
+	}
+	if vh.timecodeScale != ah.timecodeScale || vh.timecodeScale == 0 {
+		return errors.New("WebM streams have different timecode scales")
+	}
+
+	header := append([]byte{}, vh.ebml...)
+	header = append(header, 0x18, 0x53, 0x80, 0x67, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF)
+	header = append(header, encodeElement(infoID, vh.info)...)
+	header = append(header, encodeElement(tracksID, append(vh.trackEntry(1), ah.trackEntry(2)...))...)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	scale := float64(vh.timecodeScale) / 1e9
+	return interleave(w,
+		&webmFragments{r: v.r, from: vh.trackNumber(), to: 1, scale: scale},
+		&webmFragments{r: a.r, from: ah.trackNumber(), to: 2, scale: scale},
+	)
+}
+
+// webmFragments are the clusters of a WebM track. As they're written, their
+// blocks are renumbered from one track number to another.
+type webmFragments struct {
+	r        io.Reader
+	from, to uint64
+	scale    float64
+
+	cluster []byte
+	t       float64
+}
+
+// peek implements fragments
+func (f *webmFragments) peek() (float64, error) {
+	for f.cluster == nil {
+		id, size, _, err := readElementHeader(f.r)
+		if err != nil {
+			return 0, err
+		}
+		if size < 0 {
+			return 0, fmt.Errorf("unsized WebM element %X", id)
+		}
+		if id != clusterID {
+			if _, err := io.CopyN(ioutil.Discard, f.r, size); err != nil {
+				return 0, unexpected(err)
+			}
+			continue
+		}
+		if size > maxFragmentSize {
+			return 0, fmt.Errorf("WebM cluster of %d bytes", size)
+		}
+		cluster := make([]byte, size)
+		if _, err := io.ReadFull(f.r, cluster); err != nil {
+			return 0, unexpected(err)
+		}
+		f.cluster = cluster
+	}
+
+	children, err := parseElements(f.cluster)
+	if err != nil {
+		return 0, err
+	}
+	if tc := findElement(children, timecodeID); tc != nil {
+		f.t = float64(decodeUint(tc.data)) * f.scale
+	}
+	return f.t, nil
+}
+
+// write implements fragments
+func (f *webmFragments) write(w *countingWriter) error {
+	children, _ := parseElements(f.cluster)
+	for _, e := range children {
+		switch e.id {
+		case simpleBlockID:
+			if err := f.retrack(e.data); err != nil {
+				return err
+			}
+		case blockGroupID:
+			blocks, err := parseElements(e.data)
+			if err != nil {
+				return err
+			}
+			for _, b := range blocks {
+				if b.id != blockID {
+					continue
+				}
+				if err := f.retrack(b.data); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	_, err := w.Write(encodeElement(clusterID, f.cluster))
+	f.cluster = nil
+	return err
+}
+
+// retrack renumbers a block, which starts with its track number
+func (f *webmFragments) retrack(block []byte) error {
+	if len(block) == 0 || vintLen(block[0]) == 0 || vintLen(block[0]) > len(block) {
+		return errors.New("invalid WebM block")
+	}
+	n := block[:vintLen(block[0])]
+	if v, _ := vintValue(n); v == f.from {
+		putVint(n, f.to)
+	}
+	return nil
+}
@@ -3,12 +3,36 @@
 package yt
 
 import (
+	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
 )
 
 // DefaultHTTPClient is a default HTTP client
 var DefaultHTTPClient *http.Client
 
+// writeFile writes data to the named file, replacing it atomically (by
+// writing a temporary file in the same directory, and renaming it), so that
+// it's never seen half-written.
+func writeFile(name string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
 func init() {
 	DefaultHTTPClient = new(http.Client)
 }